@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	bundleFormat        = "v2tov3migrate-bundle"
+	bundleVersion       = 1
+	bundleManifestFile  = "manifest.json"
+	bundleChecksumsFile = "checksums.sha256"
+	bundleTablesDir     = "tables"
+	bundleFilesDir      = "files"
+)
+
+// bundleManifest describes the content of an export bundle.
+type bundleManifest struct {
+	Format          string        `json:"format"`
+	Version         int           `json:"version"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	V2DBDriver      string        `json:"v2DBDriver"`
+	V2LastMigration string        `json:"v2LastMigration"`
+	Tables          []bundleTable `json:"tables"`
+	Files           int           `json:"files"`
+	FilesBytes      int64         `json:"filesBytes"`
+	MissingFiles    []string      `json:"missingFiles,omitempty"`
+
+	// ChecksumsSha256 is the sha256 digest of the checksums file.
+	ChecksumsSha256 string `json:"checksumsSha256"`
+}
+
+// bundleTable describes a single exported v2 table.
+type bundleTable struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+// bundleChecksums collects the sha256 digests of the bundle files.
+type bundleChecksums struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+func (c *bundleChecksums) add(relPath string, sum []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sums[relPath] = hex.EncodeToString(sum)
+}
+
+// write writes all collected checksums in the sha256sum format
+// and returns the digest of the written file.
+func (c *bundleChecksums) write(filePath string) (string, error) {
+	keys := make([]string, 0, len(c.sums))
+	for k := range c.sums {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(c.sums[k] + "  " + k + "\n")
+	}
+
+	if err := os.WriteFile(filePath, []byte(sb.String()), 0644); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(sb.String()))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewExporter creates a new Migrator that has only the v2 source initialized
+// (used by the export command that doesn't need pb_data).
+func NewExporter(config *Config) (*Migrator, error) {
+	m := &Migrator{
+		config:      config,
+		quarantine:  &quarantine{},
+		failedFiles: &failedFiles{},
+		fileStats:   &fileCopyStats{},
+		logger:      slog.Default(),
+	}
+
+	if err := m.openSource(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Export exports all v2 tables and their referenced files in a new bundle at outDir.
+//
+// The bundle could be used later with the import command (aka. v2BundleDir config)
+// on a machine that doesn't have access to the v2 DB and storage.
+func (m *Migrator) Export(outDir string) error {
+	start := time.Now()
+
+	if entries, _ := os.ReadDir(outDir); len(entries) > 0 {
+		return fmt.Errorf("the export directory %q is not empty", outDir)
+	}
+
+	m.logger.Info("Presentator v2 export started...", "out", outDir)
+
+	problems, err := m.checkV2Schema()
+	if err != nil {
+		return fmt.Errorf("failed to inspect the Presentator v2 schema: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("incompatible Presentator v2 schema:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	if err := os.MkdirAll(filepath.Join(outDir, bundleTablesDir), os.ModePerm); err != nil {
+		return err
+	}
+
+	manifest := &bundleManifest{
+		Format:          bundleFormat,
+		Version:         bundleVersion,
+		CreatedAt:       time.Now().UTC(),
+		V2DBDriver:      m.config.V2DBDriver,
+		V2LastMigration: m.lastV2Migration(),
+	}
+
+	checksums := &bundleChecksums{sums: map[string]string{}}
+
+	fileKeys := map[string]struct{}{}
+
+	tables := slices.Clone(v2Tables)
+	if manifest.V2LastMigration != "unknown" {
+		tables = append(tables, v2Table{Name: "migration", Model: v2Migration{}})
+	}
+
+	for _, table := range tables {
+		bt, err := m.exportTable(outDir, table, checksums, func(row map[string]any) {
+			var key any
+			switch table.Name {
+			case "User":
+				key = row["avatarFilePath"]
+			case "Screen":
+				key = row["filePath"]
+			}
+			if k, ok := key.(string); ok && k != "" {
+				fileKeys[k] = struct{}{}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export table %s: %w", table.Name, err)
+		}
+
+		manifest.Tables = append(manifest.Tables, *bt)
+
+		m.logger.Info("Exported table", "table", table.Name, "rows", bt.Rows)
+	}
+
+	if err := m.exportFiles(outDir, fileKeys, checksums, manifest); err != nil {
+		return err
+	}
+
+	manifest.ChecksumsSha256, err = checksums.write(filepath.Join(outDir, bundleChecksumsFile))
+	if err != nil {
+		return err
+	}
+
+	rawManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, bundleManifestFile), rawManifest, 0644); err != nil {
+		return err
+	}
+
+	m.logger.Info(
+		"Export completed successfully.",
+		"tables", len(manifest.Tables),
+		"files", manifest.Files,
+		"missingFiles", len(manifest.MissingFiles),
+		"bytes", formatBytes(manifest.FilesBytes),
+		"elapsed", time.Since(start).String(),
+	)
+
+	return nil
+}
+
+// exportTable writes all rows of the v2 table as JSON lines.
+func (m *Migrator) exportTable(outDir string, table v2Table, checksums *bundleChecksums, onRow func(row map[string]any)) (*bundleTable, error) {
+	bt := &bundleTable{
+		Name:    table.Name,
+		File:    path.Join(bundleTablesDir, table.Name+".jsonl"),
+		Columns: table.Columns(),
+	}
+
+	f, err := os.Create(filepath.Join(outDir, filepath.FromSlash(bt.File)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, h))
+	enc := json.NewEncoder(w)
+
+	orderBy := "id asc"
+	if table.Name == "migration" {
+		orderBy = "version asc"
+	}
+
+	limit := 1000
+	items := make([]dbx.NullStringMap, 0, limit)
+	for i := 0; ; i++ {
+		q := m.oldDB.Select(bt.Columns...).
+			From(table.Name).
+			OrderBy(orderBy).
+			Limit(int64(limit)).
+			Offset(int64(i * limit))
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			row := make(map[string]any, len(item))
+			for k, v := range item {
+				if v.Valid {
+					row[k] = v.String
+				} else {
+					row[k] = nil
+				}
+			}
+
+			onRow(row)
+
+			if err := enc.Encode(row); err != nil {
+				return nil, err
+			}
+
+			bt.Rows++
+		}
+
+		if len(items) < limit {
+			break // no more items
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	checksums.add(bt.File, h.Sum(nil))
+
+	return bt, nil
+}
+
+// exportFiles copies the specified v2 file keys in the bundle files directory.
+//
+// Missing v2 files are only listed in the manifest.
+func (m *Migrator) exportFiles(outDir string, keys map[string]struct{}, checksums *bundleChecksums, manifest *bundleManifest) error {
+	var mu sync.Mutex
+
+	var group errgroup.Group
+	group.SetLimit(50)
+
+	for key := range keys {
+		group.Go(func() error {
+			relPath := path.Join(bundleFilesDir, path.Clean("/" + key)[1:])
+
+			size, sum, err := m.exportFile(key, filepath.Join(outDir, filepath.FromSlash(relPath)))
+			if errors.Is(err, filesystem.ErrNotFound) {
+				m.logger.Warn("Missing v2 file", "step", "export", "fileKey", key)
+
+				mu.Lock()
+				manifest.MissingFiles = append(manifest.MissingFiles, key)
+				mu.Unlock()
+
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to export file %q: %w", key, err)
+			}
+
+			checksums.add(relPath, sum)
+
+			mu.Lock()
+			manifest.Files++
+			manifest.FilesBytes += size
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	slices.Sort(manifest.MissingFiles)
+
+	return nil
+}
+
+func (m *Migrator) exportFile(key string, dst string) (int64, []byte, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return 0, nil, err
+	}
+
+	var size int64
+	var sum []byte
+
+	err := m.retry("v2 file read", func() error {
+		src, err := m.oldFS.GetFile(key)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+
+		size, err = io.Copy(io.MultiWriter(f, h), src)
+		if err != nil {
+			return err
+		}
+
+		sum = h.Sum(nil)
+
+		return f.Close()
+	})
+
+	return size, sum, err
+}
+
+// -------------------------------------------------------------------
+
+// loadV2Bundle verifies the export bundle at bundleDir and loads
+// its tables in a new temporary SQLite store.
+//
+// Returns the opened store and its file path (it should be removed after use).
+func loadV2Bundle(bundleDir string, logger *slog.Logger) (*dbx.DB, string, error) {
+	manifest, err := readBundleManifest(bundleDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger.Info(
+		"Verifying v2 bundle checksums...",
+		"createdAt", manifest.CreatedAt,
+		"v2DBDriver", manifest.V2DBDriver,
+		"v2LastMigration", manifest.V2LastMigration,
+	)
+
+	if err := verifyBundleChecksums(bundleDir, manifest); err != nil {
+		return nil, "", err
+	}
+
+	db, storePath, err := newTempStore()
+	if err != nil {
+		return nil, "", err
+	}
+
+	loader := newDumpLoader(nil, "")
+
+	err = loader.run(db.DB(), func() error {
+		for _, t := range manifest.Tables {
+			if err := loader.loadBundleTable(bundleDir, t); err != nil {
+				return fmt.Errorf("failed to load bundle table %s: %w", t.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		os.Remove(storePath)
+		return nil, "", err
+	}
+
+	return db, storePath, nil
+}
+
+func readBundleManifest(bundleDir string) (*bundleManifest, error) {
+	raw, err := os.ReadFile(filepath.Join(bundleDir, bundleManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bundle manifest: %w", err)
+	}
+
+	manifest := &bundleManifest{}
+	if err := json.Unmarshal(raw, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the bundle manifest: %w", err)
+	}
+
+	if manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format %q", manifest.Format)
+	}
+
+	if manifest.Version < 1 || manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d (max supported version is %d)", manifest.Version, bundleVersion)
+	}
+
+	return manifest, nil
+}
+
+// verifyBundleChecksums checks the sha256 digests of all bundle table and files.
+func verifyBundleChecksums(bundleDir string, manifest *bundleManifest) error {
+	raw, err := os.ReadFile(filepath.Join(bundleDir, bundleChecksumsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read the bundle checksums: %w", err)
+	}
+
+	if sum := sha256.Sum256(raw); hex.EncodeToString(sum[:]) != manifest.ChecksumsSha256 {
+		return errors.New("the bundle checksums file doesn't match the manifest")
+	}
+
+	var group errgroup.Group
+	group.SetLimit(10)
+
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		expected, relPath, ok := strings.Cut(line, "  ")
+		if !ok {
+			return fmt.Errorf("invalid bundle checksums line %q", line)
+		}
+
+		group.Go(func() error {
+			f, err := os.Open(filepath.Join(bundleDir, filepath.FromSlash(relPath)))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+
+			if hex.EncodeToString(h.Sum(nil)) != expected {
+				return fmt.Errorf("checksum mismatch for bundle file %q", relPath)
+			}
+
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// loadBundleTable loads the JSON lines of a single bundle table in the store.
+func (l *dumpLoader) loadBundleTable(bundleDir string, t bundleTable) error {
+	if _, ok := l.known[strings.ToLower(t.Name)]; !ok {
+		return nil // not a v2 table
+	}
+
+	table, err := l.table(t.Name, t.Columns)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(bundleDir, filepath.FromSlash(t.File)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+
+	for {
+		row := map[string]any{}
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		values := make([]any, len(t.Columns))
+		for i, col := range t.Columns {
+			values[i] = row[col]
+		}
+
+		if err := l.insert(table, t.Columns, values); err != nil {
+			return err
+		}
+	}
+
+	if table.rows != t.Rows {
+		return fmt.Errorf("expected %d rows, got %d", t.Rows, table.rows)
+	}
+
+	return nil
+}
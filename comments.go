@@ -13,6 +13,9 @@ func (m *Migrator) MigrateScreenComments() error {
 		return err
 	}
 
+	progress := m.startProgress("comments", "ScreenComment")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -22,16 +25,40 @@ func (m *Migrator) MigrateScreenComments() error {
 		q := m.oldDB.Select("*").
 			From("ScreenComment").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("ScreenComment")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			screenId, skip, err := m.resolveRef(refCommentScreen, "Screen", item.ScreenId)
+			if err != nil {
+				return err
+			}
+
+			var replyTo string
+			if item.ReplyTo != nil && !skip {
+				replyTo, skip, err = m.resolveRef(refCommentReplyTo, "ScreenComment", *item.ReplyTo)
+				if err != nil {
+					return err
+				}
+			}
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			if skip {
+				continue // dangling reference
+			}
+
+			insertedIds = append(insertedIds, m.buildRecordId("ScreenComment", item.baseModel))
+
+			record := m.initRecordToMigrate(collection, "ScreenComment", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -46,17 +73,17 @@ func (m *Migrator) MigrateScreenComments() error {
 			record.Set("left", item.Left)
 			record.Set("top", item.Top)
 			record.Set("resolved", item.Status == "resolved")
-			record.Set("screen", fmt.Sprintf("%s%d", v2Prefix, item.ScreenId))
-
-			if item.ReplyTo != nil {
-				record.Set("replyTo", fmt.Sprintf("%s%d", v2Prefix, *item.ReplyTo))
-			}
+			record.Set("screen", screenId)
+			record.Set("replyTo", replyTo)
 
 			// determine if the item.From is a project user or a guest
 			// ---
 			projectUsers, err := m.getProjectUsersByScreenId(item.ScreenId)
 			if err != nil {
-				return fmt.Errorf("failed to retrieve info for the comment %q author: %q", item.Id, err)
+				if err := m.quarantineRow("comments", "ScreenComment", item.Id, item, fmt.Errorf("failed to retrieve info for the comment %q author: %q", item.Id, err)); err != nil {
+					return err
+				}
+				continue
 			}
 
 			var matchingUserId int
@@ -67,15 +94,17 @@ func (m *Migrator) MigrateScreenComments() error {
 				}
 			}
 
-			if matchingUserId != 0 {
-				record.Set("user", fmt.Sprintf("%s%d", v2Prefix, matchingUserId))
+			if userId, ok := m.userRecordId(matchingUserId); matchingUserId != 0 && ok {
+				record.Set("user", userId)
 			} else {
 				record.Set("guestEmail", item.From)
 			}
 			// ---
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("comments", "ScreenComment", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -96,16 +125,19 @@ func (m *Migrator) MigrateScreenComments() error {
 func (m *Migrator) getProjectUsersByScreenId(screenId int) ([]*v2User, error) {
 	var result []*v2User
 
-	err := m.oldDB.NewQuery(`
-		SELECT DISTINCT u.*
-		FROM {{User}} u
-		INNER JOIN {{Screen}} s ON s.id = {:screenId}
-		INNER JOIN {{Prototype}} p ON p.id = s.prototypeId
-		INNER JOIN {{UserProjectRel}} rel ON rel.userId = u.id AND rel.projectId = p.projectId
-	`).Bind(dbx.Params{
-		"screenId": screenId,
-	}).
-		All(&result)
+	err := m.retry("v2 relation query", func() error {
+		result = nil
+		return m.oldDB.NewQuery(`
+			SELECT DISTINCT u.*
+			FROM {{User}} u
+			INNER JOIN {{Screen}} s ON s.id = {:screenId}
+			INNER JOIN {{Prototype}} p ON p.id = s.prototypeId
+			INNER JOIN {{UserProjectRel}} rel ON rel.userId = u.id AND rel.projectId = p.projectId
+		`).Bind(dbx.Params{
+			"screenId": screenId,
+		}).
+			All(&result)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
 )
 
+var idPrefixRegex = regexp.MustCompile(`^[a-z0-9_]{1,10}$`)
+
 // NewConfigFromJson reads the specified json file and returns it as new Config.
+//
+// The json file could also contain comments and trailing commas (aka. JSONC).
 func NewConfigFromJson(jsonPath string) (*Config, error) {
 	c := &Config{}
 
@@ -17,7 +26,7 @@ func NewConfigFromJson(jsonPath string) (*Config, error) {
 		return nil, fmt.Errorf("unable to read json file: %w", err)
 	}
 
-	if err := json.Unmarshal(raw, c); err != nil {
+	if err := json.Unmarshal(stripJSONComments(raw), c); err != nil {
 		return nil, fmt.Errorf("unable to parse json file: %w", err)
 	}
 
@@ -31,28 +40,146 @@ type Config struct {
 	// It is recommended to setup your Presentator v3 upfront from the Admin UI.
 	V3DataDir string `json:"v3DataDir"`
 
+	// SourceVersion is the Presentator version of the source DB and storage - "v2" (default) or "v1".
+	//
+	// The v1 data is read from the v2DBConnection (or v2DB) DB and the v1 files
+	// are expected to be in the v2 storage under their v1 "uploads/..." path.
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
 	// The v2 DB database driver to use - "mysql" or "pgx".
 	V2DBDriver string `json:"v2DBDriver"`
 
 	// The v2 DB connection string.
-	V2DBConnection string `json:"v2DBConnection"`
+	//
+	// Either V2DBConnection or the structured V2DB settings must be set!
+	V2DBConnection string     `json:"v2DBConnection,omitempty"`
+	V2DB           V2DBConfig `json:"v2DB"`
+
+	// V2DumpFile is a mysqldump or pg_dump (plain SQL format) file of the v2 DB
+	// that could be used instead of a live v2 DB server.
+	//
+	// V2DBDriver must be set to the driver of the dumped DB.
+	V2DumpFile string `json:"v2DumpFile,omitempty"`
+
+	// V2BundleDir is a bundle directory created with the export command
+	// that could be used instead of the v2 DB and storage (see the import command).
+	V2BundleDir string `json:"v2BundleDir,omitempty"`
+
+	// Optional v2 DB connection pool and session settings.
+	//
+	// To avoid loading the production v2 primary it is recommended
+	// to point the v2 DB connection to a read replica.
+	V2DBOptions V2DBOptions `json:"v2DBOptions"`
 
 	// V2 storage configuration.
 	//
-	// Either V2LocalStorage or V2S3Storage must be set!
-	V2LocalStorage string `json:"v2LocalStorage,omitempty"`
-	V2S3Storage    struct {
-		Bucket         string `json:"bucket,omitempty"`
-		Region         string `json:"region,omitempty"`
-		Endpoint       string `json:"endpoint,omitempty"`
-		AccessKey      string `json:"accessKey,omitempty"`
-		Secret         string `json:"secret,omitempty"`
-		ForcePathStyle bool   `json:"forcePathStyle,omitempty"`
-	} `json:"v2S3Storage"`
+	// Exactly one of V2LocalStorage, V2S3Storage, V2HTTPStorage or V2ArchiveStorage must be set!
+	//
+	// V2S3Storage could be used also with any S3 compatible storage
+	// (eg. Google Cloud Storage through its S3 interoperability API).
+	// SFTP storages could be migrated by mounting them locally (eg. with sshfs).
+	V2LocalStorage string    `json:"v2LocalStorage,omitempty"`
+	V2S3Storage    S3Storage `json:"v2S3Storage"`
+
+	// V2HTTPStorage is a base url from where the v2 files could be downloaded.
+	V2HTTPStorage string `json:"v2HTTPStorage,omitempty"`
+
+	// V2ArchiveStorage is a zip, tar or tar.gz backup of the v2 storage directory.
+	V2ArchiveStorage struct {
+		Path string `json:"path,omitempty"`
+
+		// Root is the optional storage directory path inside the archive (eg. "web/storage").
+		Root string `json:"root,omitempty"`
+	} `json:"v2ArchiveStorage"`
+
+	// IdPrefix is the v3 record id prefix of the migrated records (default to "pr2_").
+	//
+	// When migrating multiple v2 installations into the same v3 instance
+	// each source must have its own prefix (eg. "eu_" and "us_")
+	// and none of the prefixes should start with another one.
+	IdPrefix string `json:"idPrefix,omitempty"`
+
+	// MergeUsersByEmail links the v2 users to the existing v3 users
+	// with the same email (eg. migrated from another v2 installation)
+	// instead of creating duplicates.
+	MergeUsersByEmail bool `json:"mergeUsersByEmail,omitempty"`
+
+	// OpaqueIds generates random PocketBase-style ids for the migrated records
+	// (instead of the default guessable IdPrefix+v2Id ones).
+	//
+	// The v2 table+id -> v3 id mapping is stored in the pb_data "_migrationIdMap"
+	// collection so that the incremental runs could continue to work.
+	// It must be set on the first run of a source and it can't be changed afterwards.
+	OpaqueIds bool `json:"opaqueIds,omitempty"`
+
+	// Redirects specifies the v2 share urls redirect settings (see the redirects command).
+	Redirects RedirectsConfig `json:"redirects"`
+
+	// Optional v3 storage override.
+	//
+	// By default the files are written in the storage configured in the pb_data settings.
+	V3Storage V3Storage `json:"v3Storage"`
+
+	// Retry specifies the retry limits for the transient v2 DB and storage failures.
+	Retry RetryConfig `json:"retry"`
+
+	// FileCopyPolicy specifies how to handle the file copy errors:
+	//   - "tolerant"  - log and continue on any error (default)
+	//   - "missing"   - tolerate only missing v2 files and stop on any other error
+	//   - "threshold" - tolerate any error until the FileCopyErrorThreshold rate is exceeded
+	//   - "failfast"  - stop on the first error
+	FileCopyPolicy string `json:"fileCopyPolicy,omitempty"`
+
+	// FileCopyErrorThreshold is the max allowed ratio (0-1) of failed
+	// file copies when FileCopyPolicy is "threshold" (see [Migrator.checkFileErrorRate]).
+	FileCopyErrorThreshold float64 `json:"fileCopyErrorThreshold,omitempty"`
+
+	// ValidateImages enables the screen images validation and format normalization
+	// during the copy (see [Migrator.batchCopyScreenImages]).
+	ValidateImages bool `json:"validateImages,omitempty"`
+
+	// GenerateThumbs enables the post-step that pre-generates the v3 screen thumbs
+	// (see [Migrator.GenerateScreenThumbs]).
+	GenerateThumbs bool `json:"generateThumbs,omitempty"`
+
+	// InvalidRecords specifies how to handle the migrated records
+	// that don't pass the v3 validations:
+	//   - "force" - save the record as it is (default)
+	//   - "skip"  - skip the record
+	//   - "fix"   - reset the invalid fields to their defaults (or skip the record if still invalid)
+	//
+	// In all cases the invalid records are listed in the final quarantine report.
+	InvalidRecords string `json:"invalidRecords,omitempty"`
+
+	// MaxRowErrors is the max number of failed v2 rows (eg. invalid hotspot settings,
+	// save failure) that are quarantined before the migration is stopped (default to 100).
+	//
+	// Set it to -1 to stop the migration on the first failed row.
+	MaxRowErrors int `json:"maxRowErrors,omitempty"`
+
+	// DanglingRefs allows overwriting the default policy for handling
+	// the v2 references to missing rows (see [danglingRefs] for the available kinds):
+	//   - "drop" - skip the v2 row with the dangling reference
+	//   - "null" - migrate the v2 row but without the dangling reference
+	//   - "fail" - stop the migration before writing anything
+	//
+	// Example:
+	//	{"hotspotScreen": "fail", "commentReplyTo": "drop"}
+	DanglingRefs map[string]string `json:"danglingRefs,omitempty"`
 }
 
 // Validate performs very basic validity checks for the current Config fields.
 func (c *Config) Validate() error {
+	if err := c.ValidateTarget(); err != nil {
+		return err
+	}
+
+	return c.ValidateSource()
+}
+
+// ValidateTarget performs very basic validity checks only for the v3 target Config fields
+// (it is used also standalone by the redirect-serve command that doesn't need the v2 source).
+func (c *Config) ValidateTarget() error {
 	if c.V3DataDir == "" {
 		return errors.New("v3DataDir is not set")
 	}
@@ -61,21 +188,148 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.V3Storage.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Redirects.Validate(); err != nil {
+		return err
+	}
+
+	if c.IdPrefix != "" && !idPrefixRegex.MatchString(c.IdPrefix) {
+		return errors.New("idPrefix must contain only lowercase latin letters, digits and underscores (max 10 characters)")
+	}
+
+	switch c.FileCopyPolicy {
+	case "", fileCopyTolerant, fileCopyMissing, fileCopyThreshold, fileCopyFailFast:
+	default:
+		return fmt.Errorf("fileCopyPolicy must be %q, %q, %q or %q", fileCopyTolerant, fileCopyMissing, fileCopyThreshold, fileCopyFailFast)
+	}
+
+	if c.FileCopyErrorThreshold < 0 || c.FileCopyErrorThreshold > 1 {
+		return errors.New("fileCopyErrorThreshold must be between 0 and 1")
+	}
+
+	switch c.InvalidRecords {
+	case "", invalidRecordsForce, invalidRecordsSkip, invalidRecordsFix:
+	default:
+		return fmt.Errorf("invalidRecords must be %q, %q or %q", invalidRecordsForce, invalidRecordsSkip, invalidRecordsFix)
+	}
+
+	if c.MaxRowErrors < -1 {
+		return errors.New("maxRowErrors must be -1 or greater")
+	}
+
+	for kind, policy := range c.DanglingRefs {
+		if !slices.ContainsFunc(danglingRefs, func(ref danglingRef) bool { return ref.Kind == kind }) {
+			return fmt.Errorf("unknown danglingRefs kind %q", kind)
+		}
+
+		if policy != danglingDrop && policy != danglingNull && policy != danglingFail {
+			return fmt.Errorf("danglingRefs.%s must be %q, %q or %q", kind, danglingDrop, danglingNull, danglingFail)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSource performs very basic validity checks only for the v2 source Config fields
+// (it is used also standalone by the export command that doesn't need pb_data).
+func (c *Config) ValidateSource() error {
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+
+	switch c.SourceVersion {
+	case "", sourceV2:
+	case sourceV1:
+		if c.V2DumpFile != "" || c.V2BundleDir != "" {
+			return errors.New("sourceVersion v1 requires a live v1 DB (v2DumpFile and v2BundleDir are not supported)")
+		}
+	default:
+		return fmt.Errorf("sourceVersion must be %q or %q", sourceV2, sourceV1)
+	}
+
+	if c.V2BundleDir != "" {
+		if c.V2DBConnection != "" || c.V2DB.Host != "" || c.V2DumpFile != "" {
+			return errors.New("v2BundleDir can't be used together with v2DBConnection, v2DB or v2DumpFile")
+		}
+
+		for _, v := range []string{c.V2LocalStorage, c.V2S3Storage.Bucket, c.V2HTTPStorage, c.V2ArchiveStorage.Path} {
+			if v != "" {
+				return errors.New("v2BundleDir can't be used together with another v2 storage")
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(c.V2BundleDir, bundleManifestFile)); err != nil {
+			return fmt.Errorf("invalid v2BundleDir: %w", err)
+		}
+
+		return nil
+	}
+
 	if c.V2DBDriver == "" {
 		return errors.New("v2DBDriver name is not set")
 	}
 
-	if c.V2DBConnection == "" {
-		return errors.New("v2DBConnection is not set")
+	if c.V2DBDriver != "mysql" && c.V2DBDriver != "pgx" {
+		return fmt.Errorf("v2DBDriver must be %q or %q", "mysql", "pgx")
 	}
 
-	if c.V2LocalStorage == "" && c.V2S3Storage.Bucket == "" {
-		return errors.New("either v2LocalStorage or v2S3Storage must be set")
+	if c.V2DumpFile != "" {
+		if c.V2DBConnection != "" || c.V2DB.Host != "" {
+			return errors.New("v2DumpFile can't be used together with v2DBConnection or v2DB")
+		}
+
+		if _, err := os.Stat(c.V2DumpFile); err != nil {
+			return fmt.Errorf("invalid v2DumpFile: %w", err)
+		}
+	} else if c.V2DBConnection == "" && c.V2DB.Host == "" {
+		return errors.New("either v2DBConnection, v2DB.host or v2DumpFile must be set")
 	}
 
-	if c.V2LocalStorage != "" && c.V2S3Storage.Bucket != "" {
-		return errors.New("only one of v2LocalStorage or v2S3Storage must be set")
+	if c.V2DBConnection != "" && c.V2DB.Host != "" {
+		return errors.New("only one of v2DBConnection or v2DB must be set")
+	}
+
+	switch c.V2DB.SSLMode {
+	case "", sslModeDisable, sslModeRequire, sslModeVerifyCA, sslModeVerifyFull:
+	default:
+		return fmt.Errorf("v2DB.sslmode must be %q, %q, %q or %q", sslModeDisable, sslModeRequire, sslModeVerifyCA, sslModeVerifyFull)
+	}
+
+	if (c.V2DB.ClientCert == "") != (c.V2DB.ClientKey == "") {
+		return errors.New("both v2DB.clientCert and v2DB.clientKey must be set")
+	}
+
+	var v2Storages int
+	for _, v := range []string{c.V2LocalStorage, c.V2S3Storage.Bucket, c.V2HTTPStorage, c.V2ArchiveStorage.Path} {
+		if v != "" {
+			v2Storages++
+		}
+	}
+	if v2Storages != 1 {
+		return errors.New("exactly one of v2LocalStorage, v2S3Storage, v2HTTPStorage or v2ArchiveStorage must be set")
+	}
+
+	if err := c.V2DBOptions.Validate(); err != nil {
+		return err
+	}
+
+	if c.V2DumpFile == "" {
+		if err := c.PingV2DB(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// Hash returns a sha256 hex digest of the config.
+func (c *Config) Hash() string {
+	raw, _ := json.Marshal(c)
+
+	h := sha256.Sum256(raw)
+
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envPrefix is the prefix of all config environment variables.
+const envPrefix = "V2TOV3_"
+
+// configOverride describes a single Config field that could be
+// overwritten with an environment variable or a CLI flag.
+//
+// The precedence order (from highest to lowest) is:
+//   - CLI flag (eg. -v2-db-connection=...)
+//   - environment variable (eg. V2TOV3_V2_DB_CONNECTION=...)
+//   - environment variable with secret file path (eg. V2TOV3_V2_DB_CONNECTION_FILE=/run/secrets/dsn)
+//   - config file value
+type configOverride struct {
+	// Flag is the CLI flag name.
+	Flag string
+
+	// Env is the environment variable name (without the [envPrefix]).
+	Env string
+
+	Usage string
+
+	// Set assigns the raw override value to the related Config field.
+	Set configSetter
+}
+
+// configSetter assigns a raw override value to a single Config field.
+type configSetter struct {
+	apply func(c *Config, value string) error
+
+	// isBool indicates that the flag could be used without a value (eg. -opaque-ids).
+	isBool bool
+}
+
+// configOverrides lists all Config fields that could be overwritten.
+var configOverrides = []configOverride{
+	{"v3-data-dir", "V3_DATA_DIR", "The v3 pb_data directory", setString(func(c *Config) *string { return &c.V3DataDir })},
+	{"source-version", "SOURCE_VERSION", "The source Presentator version (v2 or v1)", setString(func(c *Config) *string { return &c.SourceVersion })},
+	{"v2-db-driver", "V2_DB_DRIVER", "The v2 DB driver (mysql or pgx)", setString(func(c *Config) *string { return &c.V2DBDriver })},
+	{"v2-db-connection", "V2_DB_CONNECTION", "The v2 DB connection string", setString(func(c *Config) *string { return &c.V2DBConnection })},
+	{"v2-db-host", "V2_DB_HOST", "The v2 DB host", setString(func(c *Config) *string { return &c.V2DB.Host })},
+	{"v2-db-port", "V2_DB_PORT", "The v2 DB port (default to 3306 for mysql and 5432 for pgx)", setInt(func(c *Config) *int { return &c.V2DB.Port })},
+	{"v2-db-user", "V2_DB_USER", "The v2 DB user", setString(func(c *Config) *string { return &c.V2DB.User })},
+	{"v2-db-password", "V2_DB_PASSWORD", "The v2 DB password", setString(func(c *Config) *string { return &c.V2DB.Password })},
+	{"v2-db-name", "V2_DB_NAME", "The v2 DB database name", setString(func(c *Config) *string { return &c.V2DB.Database })},
+	{"v2-db-sslmode", "V2_DB_SSLMODE", "The v2 DB ssl mode (disable, require, verify-ca or verify-full)", setString(func(c *Config) *string { return &c.V2DB.SSLMode })},
+	{"v2-db-ca-cert", "V2_DB_CA_CERT", "The v2 DB CA cert file path", setString(func(c *Config) *string { return &c.V2DB.CACert })},
+	{"v2-db-client-cert", "V2_DB_CLIENT_CERT", "The v2 DB client cert file path", setString(func(c *Config) *string { return &c.V2DB.ClientCert })},
+	{"v2-db-client-key", "V2_DB_CLIENT_KEY", "The v2 DB client key file path", setString(func(c *Config) *string { return &c.V2DB.ClientKey })},
+	{"v2-dump-file", "V2_DUMP_FILE", "The v2 DB mysqldump or pg_dump file (used instead of a live v2 DB)", setString(func(c *Config) *string { return &c.V2DumpFile })},
+	{"v2-bundle-dir", "V2_BUNDLE_DIR", "The v2 export bundle directory (used instead of the v2 DB and storage)", setString(func(c *Config) *string { return &c.V2BundleDir })},
+	{"v2-db-max-open-conns", "V2_DB_MAX_OPEN_CONNS", "The v2 DB max open connections", setInt(func(c *Config) *int { return &c.V2DBOptions.MaxOpenConns })},
+	{"v2-db-max-idle-conns", "V2_DB_MAX_IDLE_CONNS", "The v2 DB max idle connections", setInt(func(c *Config) *int { return &c.V2DBOptions.MaxIdleConns })},
+	{"v2-db-conn-max-lifetime", "V2_DB_CONN_MAX_LIFETIME", "The v2 DB connection max lifetime (eg. 30m)", setString(func(c *Config) *string { return &c.V2DBOptions.ConnMaxLifetime })},
+	{"v2-db-query-timeout", "V2_DB_QUERY_TIMEOUT", "The v2 DB statement timeout (eg. 30s)", setString(func(c *Config) *string { return &c.V2DBOptions.QueryTimeout })},
+	{"v2-db-read-only", "V2_DB_READ_ONLY", "Starts the v2 DB sessions in read-only mode", setBool(func(c *Config) *bool { return &c.V2DBOptions.ReadOnly })},
+	{"v2-local-storage", "V2_LOCAL_STORAGE", "The v2 local storage directory", setString(func(c *Config) *string { return &c.V2LocalStorage })},
+	{"s3-bucket", "S3_BUCKET", "The v2 S3 storage bucket", setString(func(c *Config) *string { return &c.V2S3Storage.Bucket })},
+	{"s3-region", "S3_REGION", "The v2 S3 storage region", setString(func(c *Config) *string { return &c.V2S3Storage.Region })},
+	{"s3-endpoint", "S3_ENDPOINT", "The v2 S3 storage endpoint", setString(func(c *Config) *string { return &c.V2S3Storage.Endpoint })},
+	{"s3-access-key", "S3_ACCESS_KEY", "The v2 S3 storage access key", setString(func(c *Config) *string { return &c.V2S3Storage.AccessKey })},
+	{"s3-secret", "S3_SECRET", "The v2 S3 storage secret", setString(func(c *Config) *string { return &c.V2S3Storage.Secret })},
+	{"s3-force-path-style", "S3_FORCE_PATH_STYLE", "Enables the v2 S3 storage path-style addressing", setBool(func(c *Config) *bool { return &c.V2S3Storage.ForcePathStyle })},
+	{"v2-http-storage", "V2_HTTP_STORAGE", "The v2 storage base url", setString(func(c *Config) *string { return &c.V2HTTPStorage })},
+	{"v2-archive-storage", "V2_ARCHIVE_STORAGE", "The v2 storage zip, tar or tar.gz archive path", setString(func(c *Config) *string { return &c.V2ArchiveStorage.Path })},
+	{"v2-archive-root", "V2_ARCHIVE_ROOT", "The v2 storage directory inside the archive", setString(func(c *Config) *string { return &c.V2ArchiveStorage.Root })},
+	{"id-prefix", "ID_PREFIX", "The v3 record id prefix of the migrated records (default to pr2_)", setString(func(c *Config) *string { return &c.IdPrefix })},
+	{"merge-users-by-email", "MERGE_USERS_BY_EMAIL", "Links the v2 users to the existing v3 users with the same email", setBool(func(c *Config) *bool { return &c.MergeUsersByEmail })},
+	{"opaque-ids", "OPAQUE_IDS", "Generates random PocketBase-style ids for the migrated records", setBool(func(c *Config) *bool { return &c.OpaqueIds })},
+	{"redirects-v3-url", "REDIRECTS_V3_URL", "The public v3 url of the redirects (default to the pb_data Application URL)", setString(func(c *Config) *string { return &c.Redirects.V3URL })},
+	{"v3-local-storage", "V3_LOCAL_STORAGE", "The v3 local storage directory override", setString(func(c *Config) *string { return &c.V3Storage.Local })},
+	{"v3-s3-bucket", "V3_S3_BUCKET", "The v3 S3 storage bucket override", setString(func(c *Config) *string { return &c.V3Storage.S3.Bucket })},
+	{"v3-s3-region", "V3_S3_REGION", "The v3 S3 storage region", setString(func(c *Config) *string { return &c.V3Storage.S3.Region })},
+	{"v3-s3-endpoint", "V3_S3_ENDPOINT", "The v3 S3 storage endpoint", setString(func(c *Config) *string { return &c.V3Storage.S3.Endpoint })},
+	{"v3-s3-access-key", "V3_S3_ACCESS_KEY", "The v3 S3 storage access key", setString(func(c *Config) *string { return &c.V3Storage.S3.AccessKey })},
+	{"v3-s3-secret", "V3_S3_SECRET", "The v3 S3 storage secret", setString(func(c *Config) *string { return &c.V3Storage.S3.Secret })},
+	{"v3-s3-force-path-style", "V3_S3_FORCE_PATH_STYLE", "Enables the v3 S3 storage path-style addressing", setBool(func(c *Config) *bool { return &c.V3Storage.S3.ForcePathStyle })},
+	{"v3-storage-update-settings", "V3_STORAGE_UPDATE_SETTINGS", "Updates the pb_data storage settings to match the v3 storage override", setBool(func(c *Config) *bool { return &c.V3Storage.UpdateSettings })},
+	{"retry-max-attempts", "RETRY_MAX_ATTEMPTS", "The max number of attempts for the transient v2 DB and storage failures", setInt(func(c *Config) *int { return &c.Retry.MaxAttempts })},
+	{"retry-initial-delay", "RETRY_INITIAL_DELAY", "The delay before the first retry (eg. 500ms)", setString(func(c *Config) *string { return &c.Retry.InitialDelay })},
+	{"retry-max-delay", "RETRY_MAX_DELAY", "The max delay between two retries (eg. 10s)", setString(func(c *Config) *string { return &c.Retry.MaxDelay })},
+	{"file-copy-policy", "FILE_COPY_POLICY", "How to handle file copy errors (tolerant, missing, threshold or failfast)", setString(func(c *Config) *string { return &c.FileCopyPolicy })},
+	{"file-copy-error-threshold", "FILE_COPY_ERROR_THRESHOLD", "The max allowed failed file copies ratio (0-1) for the threshold policy", setFloat(func(c *Config) *float64 { return &c.FileCopyErrorThreshold })},
+	{"validate-images", "VALIDATE_IMAGES", "Validates the screen images and converts the unsupported formats to PNG", setBool(func(c *Config) *bool { return &c.ValidateImages })},
+	{"generate-thumbs", "GENERATE_THUMBS", "Pre-generates the v3 screen thumbs after the migration", setBool(func(c *Config) *bool { return &c.GenerateThumbs })},
+	{"invalid-records", "INVALID_RECORDS", "How to handle invalid records (force, skip or fix)", setString(func(c *Config) *string { return &c.InvalidRecords })},
+	{"max-row-errors", "MAX_ROW_ERRORS", "The max number of quarantined failed v2 rows before the migration is stopped (-1 to stop on the first one)", setInt(func(c *Config) *int { return &c.MaxRowErrors })},
+}
+
+func setString(field func(c *Config) *string) configSetter {
+	return configSetter{apply: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func setInt(field func(c *Config) *int) configSetter {
+	return configSetter{apply: func(c *Config, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func setFloat(field func(c *Config) *float64) configSetter {
+	return configSetter{apply: func(c *Config, value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func setBool(field func(c *Config) *bool) configSetter {
+	return configSetter{isBool: true, apply: func(c *Config, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+// overrideFlag is a [flag.Value] that stores the raw flag value
+// so that it could be applied later with the other overrides.
+type overrideFlag struct {
+	value  string
+	isBool bool
+}
+
+// String implements [flag.Value.String].
+func (f *overrideFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+// Set implements [flag.Value.Set].
+func (f *overrideFlag) Set(value string) error {
+	if f.isBool {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return err
+		}
+	}
+	f.value = value
+	return nil
+}
+
+// IsBoolFlag allows the bool flags to be used without a value (eg. -opaque-ids).
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// registerConfigFlags registers the [configOverrides] flags in the provided flag set.
+func registerConfigFlags(fs *flag.FlagSet) {
+	for _, o := range configOverrides {
+		fs.Var(&overrideFlag{isBool: o.Set.isBool}, o.Flag, fmt.Sprintf("%s (env %s%s)", o.Usage, envPrefix, o.Env))
+	}
+}
+
+// ApplyOverrides applies the [configOverrides] environment variables
+// and the explicitly set fs flags to the current config.
+func (c *Config) ApplyOverrides(fs *flag.FlagSet) error {
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	for _, o := range configOverrides {
+		value, ok := setFlags[o.Flag]
+
+		if !ok {
+			value, ok = os.LookupEnv(envPrefix + o.Env)
+		}
+
+		if !ok {
+			var filePath string
+			if filePath, ok = os.LookupEnv(envPrefix + o.Env + "_FILE"); ok {
+				raw, err := os.ReadFile(filePath)
+				if err != nil {
+					return fmt.Errorf("failed to read %s%s_FILE: %w", envPrefix, o.Env, err)
+				}
+				value = strings.TrimRight(string(raw), "\r\n")
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := o.Set.apply(c, value); err != nil {
+			return fmt.Errorf("invalid %s value: %w", o.Flag, err)
+		}
+	}
+
+	return nil
+}
+
+// stripJSONComments removes the // and /* */ comments and the trailing
+// commas from the provided JSONC content so that it could be parsed as plain JSON.
+func stripJSONComments(raw []byte) []byte {
+	result := make([]byte, 0, len(raw))
+
+	var inString bool
+
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+
+		if inString {
+			result = append(result, ch)
+			if ch == '\\' && i+1 < len(raw) {
+				i++
+				result = append(result, raw[i])
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case ch == '"':
+			inString = true
+			result = append(result, ch)
+		case ch == '/' && i+1 < len(raw) && raw[i+1] == '/':
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+			if i < len(raw) {
+				result = append(result, '\n')
+			}
+		case ch == '/' && i+1 < len(raw) && raw[i+1] == '*':
+			end := bytes.Index(raw[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(raw)
+			} else {
+				i += end + 3
+			}
+		case ch == '}' || ch == ']':
+			// remove the trailing comma (if any)
+			trimmed := bytes.TrimRight(result, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				result = append(trimmed[:len(trimmed)-1], result[len(trimmed):]...)
+			}
+			result = append(result, ch)
+		default:
+			result = append(result, ch)
+		}
+	}
+
+	return result
+}
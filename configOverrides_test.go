@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{"plain json", `{"a": 1}`, `{"a": 1}`},
+		{"line comment", "{\n// comment\n\"a\": 1 // trailing\n}", "{\n\n\"a\": 1 \n}"},
+		{"line comment at the end", `{"a": 1} // end`, `{"a": 1} `},
+		{"block comment", `{/* a */"a": /* multi
+line */1}`, `{"a": 1}`},
+		{"unterminated block comment", `{"a": 1} /* end`, `{"a": 1} `},
+		{"comment markers in string", `{"a": "http://x/*y*/"}`, `{"a": "http://x/*y*/"}`},
+		{"escaped quote in string", `{"a": "b\"//c"}`, `{"a": "b\"//c"}`},
+		{"trailing object comma", "{\"a\": 1,\n}", "{\"a\": 1\n}"},
+		{"trailing array comma", `{"a": [1, 2, ]}`, `{"a": [1, 2 ]}`},
+		{"trailing comma before comment", "{\"a\": 1, // c\n}", "{\"a\": 1 \n}"},
+		{"comma in string", `{"a": ",}"}`, `{"a": ",}"}`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result := string(stripJSONComments([]byte(s.raw)))
+			if result != s.expected {
+				t.Fatalf("expected\n%q\ngot\n%q", s.expected, result)
+			}
+
+			if !json.Valid([]byte(result)) {
+				t.Fatalf("expected valid json, got %q", result)
+			}
+		})
+	}
+}
+
+func TestApplyOverridesFlags(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		args        []string
+		expectError bool
+		check       func(c *Config) bool
+	}{
+		{"bool flag without value", []string{"-opaque-ids", "-v3-data-dir", "pb_data"}, false, func(c *Config) bool {
+			return c.OpaqueIds && c.V3DataDir == "pb_data"
+		}},
+		{"bool flag with value", []string{"-validate-images=false", "-generate-thumbs=true"}, false, func(c *Config) bool {
+			return !c.ValidateImages && c.GenerateThumbs
+		}},
+		{"invalid bool flag", []string{"-opaque-ids=abc"}, true, nil},
+		{"int flag", []string{"-max-row-errors", "5"}, false, func(c *Config) bool {
+			return c.MaxRowErrors == 5
+		}},
+		{"invalid int flag", []string{"-max-row-errors", "abc"}, true, nil},
+		{"float flag", []string{"-file-copy-error-threshold", "0.1"}, false, func(c *Config) bool {
+			return c.FileCopyErrorThreshold == 0.1
+		}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			registerConfigFlags(fs)
+
+			c := &Config{ValidateImages: true}
+
+			err := fs.Parse(s.args)
+			if err == nil {
+				err = c.ApplyOverrides(fs)
+			}
+
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if s.check != nil && !s.check(c) {
+				t.Fatalf("unexpected config %+v", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// v2TableState describes the state of a single v2 table.
+type v2TableState struct {
+	Name         string
+	Count        int
+	MaxUpdatedAt string
+}
+
+// v2Snapshot describes the state of all v2 tables at a specific time.
+type v2Snapshot struct {
+	TakenAt time.Time
+	Tables  []v2TableState
+}
+
+// Equal reports whether both snapshots have the same tables state.
+func (s *v2Snapshot) Equal(other *v2Snapshot) bool {
+	return slices.Equal(s.Tables, other.Tables)
+}
+
+// Digest returns a sha256 hex digest of the snapshot tables state.
+func (s *v2Snapshot) Digest() string {
+	h := sha256.New()
+
+	for _, t := range s.Tables {
+		fmt.Fprintf(h, "%s:%d:%s\n", t.Name, t.Count, t.MaxUpdatedAt)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// takeV2Snapshot returns the current rows count and max updatedAt of all v2 tables.
+func (m *Migrator) takeV2Snapshot() (*v2Snapshot, error) {
+	snapshot := &v2Snapshot{
+		TakenAt: time.Now(),
+		Tables:  make([]v2TableState, 0, len(v2Tables)),
+	}
+
+	for _, table := range v2Tables {
+		var count int
+		var maxUpdatedAt sql.NullString
+
+		err := m.oldDB.Select("count(*)", "max([[updatedAt]])").
+			From(table.Name).
+			Row(&count, &maxUpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the %s table state: %w", table.Name, err)
+		}
+
+		snapshot.Tables = append(snapshot.Tables, v2TableState{
+			Name:         table.Name,
+			Count:        count,
+			MaxUpdatedAt: maxUpdatedAt.String,
+		})
+	}
+
+	return snapshot, nil
+}
+
+// Cutover is intended to be used for the final sync before switching to v3.
+//
+// It executes [Migrator.MigrateAll] until the v2 tables state before
+// and after the run are identical (aka. v2 was not changed during the run)
+// and prints a summary with the final v2 state digest.
+//
+// Returns an error if the v2 state is still changing after maxRuns.
+func (m *Migrator) Cutover(maxRuns int) error {
+	if m.dumpStore != "" {
+		return errors.New("cutover is not supported with v2DumpFile, v2BundleDir or a v1 source")
+	}
+
+	start := time.Now()
+
+	before, err := m.takeV2Snapshot()
+	if err != nil {
+		return err
+	}
+
+	for run := 1; run <= maxRuns; run++ {
+		m.logger.Info("Cutover run started...", "run", run, "v2Digest", before.Digest())
+
+		if err := m.MigrateAll(); err != nil {
+			return err
+		}
+
+		after, err := m.takeV2Snapshot()
+		if err != nil {
+			return err
+		}
+
+		if before.Equal(after) {
+			m.logCutoverSummary(after, run, time.Since(start))
+			return nil
+		}
+
+		m.logger.Warn("v2 was changed during the cutover run, repeating...", "run", run)
+
+		before = after
+	}
+
+	return fmt.Errorf("v2 was still changing after %d cutover runs - make sure that v2 writes are frozen", maxRuns)
+}
+
+func (m *Migrator) logCutoverSummary(snapshot *v2Snapshot, runs int, elapsed time.Duration) {
+	for _, t := range snapshot.Tables {
+		m.logger.Info("Cutover v2 table state", "table", t.Name, "rows", t.Count, "maxUpdatedAt", t.MaxUpdatedAt)
+	}
+
+	m.logger.Info(
+		"Cutover completed - v2 was not changed during the last run.",
+		"runs", runs,
+		"elapsed", elapsed.String(),
+		"snapshotTakenAt", snapshot.TakenAt.UTC().Format(time.RFC3339),
+		"signedOffDigest", "sha256:"+snapshot.Digest(),
+	)
+}
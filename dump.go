@@ -0,0 +1,914 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+)
+
+// v2Migration is the Yii2 migrations history table model
+// (used only to detect the v2 schema version).
+type v2Migration struct {
+	Version   string `db:"version"`
+	ApplyTime int    `db:"apply_time"`
+}
+
+// loadV2Dump parses the INSERT (and pg_dump COPY) statements of the [v2Tables]
+// from the provided mysqldump or pg_dump file into a new temporary SQLite store.
+//
+// dialect must be the driver of the dumped database - "mysql" or "pgx".
+//
+// Returns the opened store and its file path (it should be removed after use).
+func loadV2Dump(dumpPath string, dialect string, logger *slog.Logger) (*dbx.DB, string, error) {
+	dumpFile, err := os.Open(dumpPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open v2DumpFile: %w", err)
+	}
+	defer dumpFile.Close()
+
+	db, storePath, err := newTempStore()
+	if err != nil {
+		return nil, "", err
+	}
+
+	loader := newDumpLoader(&dumpReader{r: bufio.NewReaderSize(dumpFile, 1<<20), dialect: dialect}, dialect)
+
+	if err := loader.run(db.DB(), loader.readAll); err != nil {
+		db.Close()
+		os.Remove(storePath)
+		return nil, "", fmt.Errorf("failed to load v2DumpFile (line %d): %w", loader.reader.line, err)
+	}
+
+	for _, t := range loader.tables {
+		logger.Debug("Loaded v2 dump table", "table", t.name, "rows", t.rows)
+	}
+
+	return db, storePath, nil
+}
+
+// dumpTable holds the state of a single v2 table loaded from the dump.
+type dumpTable struct {
+	name    string
+	columns []string
+	types   map[string]string
+	stmts   map[string]*sql.Stmt
+	rows    int
+}
+
+type dumpLoader struct {
+	reader  *dumpReader
+	dialect string
+	tx      *sql.Tx
+
+	// known holds the v2 tables to load, keyed by their lowercased name
+	known map[string]v2Table
+
+	// tables holds the loaded v2 tables, keyed by their lowercased name
+	tables map[string]*dumpTable
+}
+
+// newTempStore creates a new temporary SQLite store for the v2 data.
+//
+// Returns the opened store and its file path (it should be removed after use).
+func newTempStore() (*dbx.DB, string, error) {
+	storeFile, err := os.CreateTemp("", "v2tov3_store_*.db")
+	if err != nil {
+		return nil, "", err
+	}
+	storeFile.Close()
+	storePath := storeFile.Name()
+
+	db, err := dbx.Open("sqlite", storePath+"?_pragma=journal_mode(OFF)&_pragma=synchronous(OFF)")
+	if err != nil {
+		os.Remove(storePath)
+		return nil, "", err
+	}
+
+	return db, storePath, nil
+}
+
+// newDumpLoader creates a new loader for the [v2Tables] (and the Yii2 migration table).
+//
+// reader is optional and it is used only for loading SQL dump files.
+func newDumpLoader(reader *dumpReader, dialect string) *dumpLoader {
+	l := &dumpLoader{
+		reader:  reader,
+		dialect: dialect,
+		known:   map[string]v2Table{},
+		tables:  map[string]*dumpTable{},
+	}
+
+	l.known["migration"] = v2Table{Name: "migration", Model: v2Migration{}}
+	for _, t := range v2Tables {
+		l.known[strings.ToLower(t.Name)] = t
+	}
+
+	return l
+}
+
+// run executes fn in a single store transaction.
+func (l *dumpLoader) run(db *sql.DB, fn func() error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	l.tx = tx
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// readAll executes all dump statements.
+func (l *dumpLoader) readAll() error {
+	for {
+		stmt, err := l.reader.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := l.exec(stmt); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *dumpLoader) exec(stmt string) error {
+	lex := &sqlLexer{s: stmt, dialect: l.dialect}
+
+	switch {
+	case lex.consumeKeywords("CREATE", "TABLE"):
+		lex.consumeKeywords("IF", "NOT", "EXISTS")
+		return l.execCreateTable(lex)
+	case lex.consumeKeywords("INSERT", "INTO"), lex.consumeKeywords("INSERT", "IGNORE", "INTO"):
+		return l.execInsert(lex)
+	case lex.consumeKeywords("COPY"):
+		return l.execCopy(lex)
+	default:
+		return nil // not relevant
+	}
+}
+
+// execCreateTable defines a v2 table from its CREATE TABLE statement.
+func (l *dumpLoader) execCreateTable(lex *sqlLexer) error {
+	name, err := lex.qualifiedIdent()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := l.known[strings.ToLower(name)]; !ok {
+		return nil // not a v2 table
+	}
+
+	columns, err := lex.columnDefinitions()
+	if err != nil {
+		return fmt.Errorf("failed to parse CREATE TABLE %s: %w", name, err)
+	}
+
+	_, err = l.table(name, columns)
+
+	return err
+}
+
+// execInsert loads the rows of a single INSERT statement.
+func (l *dumpLoader) execInsert(lex *sqlLexer) error {
+	name, err := lex.qualifiedIdent()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := l.known[strings.ToLower(name)]; !ok {
+		return nil // not a v2 table
+	}
+
+	var columns []string
+	if lex.peek() == '(' {
+		if columns, err = lex.identList(); err != nil {
+			return err
+		}
+	}
+
+	table, err := l.table(name, columns)
+	if err != nil {
+		return err
+	}
+	if columns == nil {
+		columns = table.columns
+	}
+
+	if !lex.consumeKeywords("VALUES") {
+		return fmt.Errorf("unsupported INSERT INTO %s statement (expected VALUES)", name)
+	}
+
+	for {
+		values, err := lex.valuesTuple()
+		if err != nil {
+			return fmt.Errorf("failed to parse INSERT INTO %s values: %w", name, err)
+		}
+
+		if err := l.insert(table, columns, values); err != nil {
+			return err
+		}
+
+		if lex.skipSpace(); lex.peek() != ',' {
+			break
+		}
+		lex.pos++
+	}
+
+	return nil
+}
+
+// execCopy loads the rows of a pg_dump COPY ... FROM stdin statement.
+func (l *dumpLoader) execCopy(lex *sqlLexer) error {
+	name, err := lex.qualifiedIdent()
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	if lex.peek() == '(' {
+		if columns, err = lex.identList(); err != nil {
+			return err
+		}
+	}
+
+	var table *dumpTable
+	if _, ok := l.known[strings.ToLower(name)]; ok {
+		if table, err = l.table(name, columns); err != nil {
+			return err
+		}
+		if columns == nil {
+			columns = table.columns
+		}
+	}
+
+	// the data rows follow the statement until the "\." line
+	for {
+		line, err := l.reader.readLine()
+		if err != nil {
+			return fmt.Errorf("unterminated COPY %s data: %w", name, err)
+		}
+
+		if line == `\.` {
+			return nil
+		}
+
+		if table == nil {
+			continue // not a v2 table
+		}
+
+		fields := strings.Split(line, "\t")
+		values := make([]any, len(fields))
+		for i, f := range fields {
+			if f == `\N` {
+				values[i] = nil
+			} else {
+				values[i] = unescapeCopyValue(f)
+			}
+		}
+
+		if err := l.insert(table, columns, values); err != nil {
+			return err
+		}
+	}
+}
+
+// table returns the loaded table with the specified name
+// (the table is created in the store on first access).
+func (l *dumpLoader) table(name string, columns []string) (*dumpTable, error) {
+	key := strings.ToLower(name)
+
+	if t, ok := l.tables[key]; ok {
+		return t, nil
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("missing CREATE TABLE statement or column names for table %s", name)
+	}
+
+	known := l.known[key]
+
+	types := map[string]string{}
+	for _, f := range modelFields(reflect.TypeOf(known.Model)) {
+		types[f.Tag.Get("db")] = sqliteColumnType(f.Type)
+	}
+
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = strings.TrimSpace(quoteSQLiteIdent(col) + " " + types[col])
+	}
+
+	// use the canonical v2 table name so that it could be found by the migrators
+	_, err := l.tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteSQLiteIdent(known.Name), strings.Join(defs, ", ")))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &dumpTable{
+		name:    known.Name,
+		columns: columns,
+		types:   types,
+		stmts:   map[string]*sql.Stmt{},
+	}
+	l.tables[key] = t
+
+	return t, nil
+}
+
+func (l *dumpLoader) insert(table *dumpTable, columns []string, values []any) error {
+	if len(columns) != len(values) {
+		return fmt.Errorf("%s row with %d values for %d columns", table.name, len(values), len(columns))
+	}
+
+	cacheKey := strings.Join(columns, ",")
+
+	stmt, ok := table.stmts[cacheKey]
+	if !ok {
+		quoted := make([]string, len(columns))
+		placeholders := make([]string, len(columns))
+		for i, col := range columns {
+			quoted[i] = quoteSQLiteIdent(col)
+			placeholders[i] = "?"
+		}
+
+		var err error
+		stmt, err = l.tx.Prepare(fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES (%s)",
+			quoteSQLiteIdent(table.name),
+			strings.Join(quoted, ", "),
+			strings.Join(placeholders, ", "),
+		))
+		if err != nil {
+			return err
+		}
+		table.stmts[cacheKey] = stmt
+	}
+
+	// normalize the Postgres booleans for the integer columns
+	for i, v := range values {
+		if table.types[columns[i]] != "INTEGER" {
+			continue
+		}
+		switch v {
+		case "t", "true":
+			values[i] = 1
+		case "f", "false":
+			values[i] = 0
+		}
+	}
+
+	if _, err := stmt.Exec(values...); err != nil {
+		return fmt.Errorf("failed to insert %s row: %w", table.name, err)
+	}
+
+	table.rows++
+
+	return nil
+}
+
+// sqliteColumnType returns the SQLite column type for the provided model field type.
+func sqliteColumnType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Bool:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+func quoteSQLiteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// unescapeCopyValue decodes a single pg_dump COPY text format value.
+func unescapeCopyValue(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i+1 >= len(v) {
+			sb.WriteByte(v[i])
+			continue
+		}
+
+		i++
+		switch c := v[i]; c {
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		default:
+			if c >= '0' && c <= '7' {
+				end := i + 1
+				for end < len(v) && end < i+3 && v[end] >= '0' && v[end] <= '7' {
+					end++
+				}
+				n, _ := strconv.ParseUint(v[i:end], 8, 8)
+				sb.WriteByte(byte(n))
+				i = end - 1
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// -------------------------------------------------------------------
+
+// dumpReader splits the dump file into separate SQL statements.
+type dumpReader struct {
+	r       *bufio.Reader
+	dialect string
+	line    int
+}
+
+// readLine returns the next raw line (without the line ending).
+func (d *dumpReader) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	d.line++
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// next returns the next full SQL statement (without the trailing semicolon).
+//
+// Comment lines are skipped.
+func (d *dumpReader) next() (string, error) {
+	var sb strings.Builder
+
+	var quote byte       // the current quote char (if any)
+	var dollarTag string // the current Postgres dollar quote tag (if any)
+
+	for {
+		line, err := d.readLine()
+		if err == io.EOF && sb.Len() > 0 {
+			return "", errors.New("unterminated SQL statement")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if sb.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+		}
+
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+
+			switch {
+			case dollarTag != "":
+				if strings.HasPrefix(line[i:], dollarTag) {
+					i += len(dollarTag) - 1
+					dollarTag = ""
+				}
+			case quote != 0:
+				if c == '\\' && quote == '\'' && d.dialect == "mysql" {
+					i++ // skip the escaped char
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '\'' || c == '"' || c == '`':
+				quote = c
+			case c == '$' && d.dialect == "pgx":
+				if end := strings.IndexByte(line[i+1:], '$'); end >= 0 && isDollarTag(line[i+1:i+1+end]) {
+					dollarTag = line[i : i+end+2]
+					i += end + 1
+				}
+			}
+		}
+
+		sb.WriteString(line)
+
+		if quote == 0 && dollarTag == "" && strings.HasSuffix(strings.TrimSpace(line), ";") {
+			stmt := strings.TrimSpace(sb.String())
+			return strings.TrimSuffix(stmt, ";"), nil
+		}
+
+		sb.WriteByte('\n')
+	}
+}
+
+func isDollarTag(tag string) bool {
+	for _, c := range tag {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// -------------------------------------------------------------------
+
+// sqlLexer is a minimal tokenizer for the dump CREATE TABLE, INSERT and COPY statements.
+type sqlLexer struct {
+	s       string
+	pos     int
+	dialect string
+}
+
+func (l *sqlLexer) skipSpace() {
+	for l.pos < len(l.s) && strings.ContainsRune(" \t\r\n", rune(l.s[l.pos])) {
+		l.pos++
+	}
+}
+
+func (l *sqlLexer) peek() byte {
+	l.skipSpace()
+
+	if l.pos >= len(l.s) {
+		return 0
+	}
+
+	return l.s[l.pos]
+}
+
+// consumeKeywords consumes the specified case insensitive keywords sequence.
+//
+// The lexer position is not changed if the keywords don't match.
+func (l *sqlLexer) consumeKeywords(keywords ...string) bool {
+	start := l.pos
+
+	for _, kw := range keywords {
+		l.skipSpace()
+
+		end := l.pos + len(kw)
+		if end > len(l.s) || !strings.EqualFold(l.s[l.pos:end], kw) || (end < len(l.s) && isIdentChar(l.s[end])) {
+			l.pos = start
+			return false
+		}
+
+		l.pos = end
+	}
+
+	return true
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// ident parses a single quoted or bare identifier.
+func (l *sqlLexer) ident() (string, error) {
+	l.skipSpace()
+
+	if l.pos >= len(l.s) {
+		return "", errors.New("missing identifier")
+	}
+
+	if q := l.s[l.pos]; q == '`' || q == '"' {
+		return l.quoted(q)
+	}
+
+	start := l.pos
+	for l.pos < len(l.s) && isIdentChar(l.s[l.pos]) {
+		l.pos++
+	}
+
+	if start == l.pos {
+		return "", fmt.Errorf("invalid identifier at %q", l.rest())
+	}
+
+	return l.s[start:l.pos], nil
+}
+
+// qualifiedIdent parses an optionally qualified identifier
+// (eg. public."User") and returns only its last part.
+func (l *sqlLexer) qualifiedIdent() (string, error) {
+	name, err := l.ident()
+	if err != nil {
+		return "", err
+	}
+
+	for l.pos < len(l.s) && l.s[l.pos] == '.' {
+		l.pos++
+		if name, err = l.ident(); err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// identList parses a parenthesized list of identifiers.
+func (l *sqlLexer) identList() ([]string, error) {
+	if l.peek() != '(' {
+		return nil, errors.New("expected (")
+	}
+	l.pos++
+
+	var result []string
+
+	for {
+		name, err := l.ident()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+
+		switch l.peek() {
+		case ',':
+			l.pos++
+		case ')':
+			l.pos++
+			return result, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q in identifiers list", l.rest())
+		}
+	}
+}
+
+// columnDefinitions parses the CREATE TABLE column definitions
+// and returns their names (the table constraints are skipped).
+func (l *sqlLexer) columnDefinitions() ([]string, error) {
+	if l.peek() != '(' {
+		return nil, errors.New("expected (")
+	}
+	l.pos++
+
+	var result []string
+
+	for {
+		if l.peek() == ')' {
+			return result, nil
+		}
+
+		isQuoted := l.peek() == '`' || l.peek() == '"'
+
+		name, err := l.ident()
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToUpper(name) {
+		case "PRIMARY", "KEY", "UNIQUE", "INDEX", "CONSTRAINT", "FOREIGN", "FULLTEXT", "SPATIAL", "CHECK", "EXCLUDE":
+			if !isQuoted {
+				break // table constraint
+			}
+			fallthrough
+		default:
+			result = append(result, name)
+		}
+
+		if err := l.skipDefinition(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipDefinition skips the current column or constraint definition
+// until the next top level comma (consumed) or closing parenthesis (not consumed).
+func (l *sqlLexer) skipDefinition() error {
+	var depth int
+
+	for l.pos < len(l.s) {
+		switch c := l.s[l.pos]; c {
+		case '\'', '"', '`':
+			if _, err := l.quoted(c); err != nil {
+				return err
+			}
+			continue
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				l.pos++
+				return nil
+			}
+		}
+		l.pos++
+	}
+
+	return errors.New("unterminated definition")
+}
+
+// quoted parses a quoted string or identifier starting at the current position.
+func (l *sqlLexer) quoted(q byte) (string, error) {
+	return l.quotedWithEscapes(q, q == '\'' && l.dialect == "mysql")
+}
+
+func (l *sqlLexer) quotedWithEscapes(q byte, backslashEscapes bool) (string, error) {
+	l.pos++ // opening quote
+
+	var sb strings.Builder
+
+	for l.pos < len(l.s) {
+		c := l.s[l.pos]
+
+		if backslashEscapes && c == '\\' && l.pos+1 < len(l.s) {
+			l.pos += 2
+			switch e := l.s[l.pos-1]; e {
+			case '0':
+				sb.WriteByte(0)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'Z':
+				sb.WriteByte(0x1a)
+			default:
+				sb.WriteByte(e)
+			}
+			continue
+		}
+
+		if c == q {
+			// doubled quote escape
+			if l.pos+1 < len(l.s) && l.s[l.pos+1] == q {
+				sb.WriteByte(q)
+				l.pos += 2
+				continue
+			}
+
+			l.pos++
+			return sb.String(), nil
+		}
+
+		sb.WriteByte(c)
+		l.pos++
+	}
+
+	return "", errors.New("unterminated quoted value")
+}
+
+// valuesTuple parses a single parenthesized VALUES tuple.
+func (l *sqlLexer) valuesTuple() ([]any, error) {
+	if l.peek() != '(' {
+		return nil, fmt.Errorf("expected ( at %q", l.rest())
+	}
+	l.pos++
+
+	var result []any
+
+	for {
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+
+		switch l.peek() {
+		case ',':
+			l.pos++
+		case ')':
+			l.pos++
+			return result, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q in values list", l.rest())
+		}
+	}
+}
+
+// value parses a single literal value.
+func (l *sqlLexer) value() (any, error) {
+	c := l.peek()
+
+	var result any
+
+	switch {
+	case c == '\'':
+		v, err := l.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		result = v
+	case (c == 'E' || c == 'e') && l.pos+1 < len(l.s) && l.s[l.pos+1] == '\'':
+		// Postgres escape string
+		l.pos++
+		v, err := l.quotedWithEscapes('\'', true)
+		if err != nil {
+			return nil, err
+		}
+		result = v
+	case c == '_' && l.dialect == "mysql":
+		// MySQL charset introducer (eg. _binary '...')
+		if _, err := l.ident(); err != nil {
+			return nil, err
+		}
+		return l.value()
+	default:
+		start := l.pos
+		for l.pos < len(l.s) && !strings.ContainsRune(",) \t\r\n", rune(l.s[l.pos])) && !strings.HasPrefix(l.s[l.pos:], "::") {
+			l.pos++
+		}
+		raw := l.s[start:l.pos]
+
+		switch strings.ToUpper(raw) {
+		case "":
+			return nil, fmt.Errorf("missing value at %q", l.rest())
+		case "NULL":
+			result = nil
+		case "TRUE":
+			result = 1
+		case "FALSE":
+			result = 0
+		default:
+			result = raw
+		}
+	}
+
+	// skip Postgres type casts (eg. '...'::text, 1::numeric(10,2), '...'::timestamp without time zone)
+	if l.peek() == ':' && strings.HasPrefix(l.s[l.pos:], "::") {
+		if err := l.skipTypeCast(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// skipTypeCast skips the current type cast(s) until the next top level
+// comma or closing parenthesis (not consumed).
+func (l *sqlLexer) skipTypeCast() error {
+	var depth int
+
+	for l.pos < len(l.s) {
+		switch c := l.s[l.pos]; c {
+		case '"':
+			if _, err := l.quoted(c); err != nil {
+				return err
+			}
+			continue
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return nil
+			}
+		}
+		l.pos++
+	}
+
+	return nil
+}
+
+func (l *sqlLexer) rest() string {
+	rest := l.s[min(l.pos, len(l.s)):]
+	if len(rest) > 30 {
+		rest = rest[:30] + "..."
+	}
+
+	return rest
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpReaderNext(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		dialect     string
+		dump        string
+		expected    []string
+		expectError bool
+	}{
+		{
+			"comments and blank lines",
+			"mysql",
+			"-- comment\n# comment\n\n  \nSELECT 1;\n-- end\n",
+			[]string{"SELECT 1"},
+			false,
+		},
+		{
+			"multi-line statement",
+			"mysql",
+			"INSERT INTO `a`\nVALUES (1),\n(2);\nSELECT 2;",
+			[]string{"INSERT INTO `a`\nVALUES (1),\n(2)", "SELECT 2"},
+			false,
+		},
+		{
+			"crlf line endings",
+			"mysql",
+			"SELECT 1;\r\nSELECT\r\n2;\r\n",
+			[]string{"SELECT 1", "SELECT\n2"},
+			false,
+		},
+		{
+			"semicolon and comment markers in string",
+			"mysql",
+			"INSERT INTO a VALUES ('x;\n-- y;');\nSELECT 2;",
+			[]string{"INSERT INTO a VALUES ('x;\n-- y;')", "SELECT 2"},
+			false,
+		},
+		{
+			"mysql backslash escaped quote",
+			"mysql",
+			`INSERT INTO a VALUES ('it\'s;');` + "\nSELECT 2;",
+			[]string{`INSERT INTO a VALUES ('it\'s;')`, "SELECT 2"},
+			false,
+		},
+		{
+			"doubled quote",
+			"pgx",
+			"INSERT INTO a VALUES ('it''s;');\nSELECT 2;",
+			[]string{"INSERT INTO a VALUES ('it''s;')", "SELECT 2"},
+			false,
+		},
+		{
+			"quoted identifiers",
+			"pgx",
+			"INSERT INTO \"a;\" VALUES (1);\nSELECT 2;",
+			[]string{"INSERT INTO \"a;\" VALUES (1)", "SELECT 2"},
+			false,
+		},
+		{
+			"pgx dollar quoting",
+			"pgx",
+			"CREATE FUNCTION f() RETURNS int AS $body$\nSELECT 1;\n$body$;\nCREATE FUNCTION g() AS $$ SELECT ';'; $$;",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $body$\nSELECT 1;\n$body$", "CREATE FUNCTION g() AS $$ SELECT ';'; $$"},
+			false,
+		},
+		{
+			"mysql dollar sign",
+			"mysql",
+			"SELECT $a$;\nSELECT 2;",
+			[]string{"SELECT $a$", "SELECT 2"},
+			false,
+		},
+		{
+			"unterminated statement",
+			"mysql",
+			"SELECT 1;\nINSERT INTO a VALUES ('x;\n",
+			[]string{"SELECT 1"},
+			true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			reader := &dumpReader{r: bufio.NewReader(strings.NewReader(s.dump)), dialect: s.dialect}
+
+			var stmts []string
+			var err error
+
+			for {
+				var stmt string
+				stmt, err = reader.next()
+				if err != nil {
+					break
+				}
+				stmts = append(stmts, stmt)
+			}
+
+			if hasErr := err != io.EOF; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if !reflect.DeepEqual(stmts, s.expected) {
+				t.Fatalf("expected statements\n%q\ngot\n%q", s.expected, stmts)
+			}
+		})
+	}
+}
+
+func TestSQLLexerValuesTuple(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		dialect     string
+		tuple       string
+		expected    []any
+		expectError bool
+	}{
+		{
+			"mysql literals",
+			"mysql",
+			`(1, -1.5, 'a', NULL, TRUE, false)`,
+			[]any{"1", "-1.5", "a", nil, 1, 0},
+			false,
+		},
+		{
+			"mysql escapes",
+			"mysql",
+			`('it\'s','c''d','a\nb\tc\0','\\\Z','\%')`,
+			[]any{"it's", "c'd", "a\nb\tc\x00", "\\\x1a", "%"},
+			false,
+		},
+		{
+			"mysql charset introducer",
+			"mysql",
+			`(_binary 'x',_utf8mb4'y')`,
+			[]any{"x", "y"},
+			false,
+		},
+		{
+			"pgx literals",
+			"pgx",
+			`( 1 ,'a\b', 'c''d' , NULL,true)`,
+			[]any{"1", `a\b`, "c'd", nil, 1},
+			false,
+		},
+		{
+			"pgx escape string",
+			"pgx",
+			`(E'a\nb\'c', e'\\')`,
+			[]any{"a\nb'c", `\`},
+			false,
+		},
+		{
+			"pgx type casts",
+			"pgx",
+			`('x'::text, 'y'::public."t,)", 1::int, '2'::numeric(10,2)::text, '2024-01-01'::timestamp without time zone)`,
+			[]any{"x", "y", "1", "2", "2024-01-01"},
+			false,
+		},
+		{"missing open paren", "mysql", `1, 2)`, nil, true},
+		{"missing value", "mysql", `(1,)`, nil, true},
+		{"unterminated string", "mysql", `('a)`, nil, true},
+		{"unterminated tuple", "mysql", `(1, 2`, nil, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			lex := &sqlLexer{s: s.tuple, dialect: s.dialect}
+
+			values, err := lex.valuesTuple()
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if !s.expectError && !reflect.DeepEqual(values, s.expected) {
+				t.Fatalf("expected values\n%#v\ngot\n%#v", s.expected, values)
+			}
+		})
+	}
+}
+
+func TestSQLLexerColumnDefinitions(t *testing.T) {
+	stmt := "(\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  `title` varchar(255) DEFAULT 'a, (b)',\n" +
+		"  \"key\" text,\n" +
+		"  `price` decimal(10,2),\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `idx` (`title`,`price`),\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`id`) REFERENCES `b` (`id`)\n" +
+		") ENGINE=InnoDB"
+
+	lex := &sqlLexer{s: stmt, dialect: "mysql"}
+
+	columns, err := lex.columnDefinitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"id", "title", "key", "price"}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("expected columns %v, got %v", expected, columns)
+	}
+}
+
+func TestUnescapeCopyValue(t *testing.T) {
+	scenarios := []struct {
+		value    string
+		expected string
+	}{
+		{"abc", "abc"},
+		{`a\tb\nc\rd`, "a\tb\nc\rd"},
+		{`\b\f\v`, "\b\f\v"},
+		{`a\\b`, `a\b`},
+		{`\101\60x`, "A0x"},
+		{`\x`, "x"},
+		{`a\`, `a\`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.value, func(t *testing.T) {
+			if result := unescapeCopyValue(s.value); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoadV2DumpPgCopy(t *testing.T) {
+	dump := strings.Join([]string{
+		"-- pg_dump",
+		"SET standard_conforming_strings = on;",
+		"CREATE TABLE public.migration (",
+		"    version character varying(180) NOT NULL,",
+		"    apply_time integer",
+		");",
+		"COPY public.other (a) FROM stdin;",
+		"x;",
+		`\.`,
+		"COPY public.migration (version, apply_time) FROM stdin;",
+		"m1\t100",
+		`m2\ttab	\N`,
+		`\.`,
+		"INSERT INTO public.migration VALUES ('m3', 300), ('m4;', NULL);",
+		"",
+	}, "\n")
+
+	dumpPath := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(dumpPath, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, storePath, err := loadV2Dump(dumpPath, "pgx", slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(storePath)
+	})
+
+	rows := []v2Migration{}
+	if err := db.Select("version", "coalesce(apply_time, 0) as apply_time").From("migration").OrderBy("version").All(&rows); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []v2Migration{{"m1", 100}, {"m2\ttab", 0}, {"m3", 300}, {"m4;", 0}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("expected rows %v, got %v", expected, rows)
+	}
+}
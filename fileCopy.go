@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"gocloud.dev/gcerrors"
+)
+
+const (
+	fileCopyTolerant  = "tolerant"
+	fileCopyMissing   = "missing"
+	fileCopyThreshold = "threshold"
+	fileCopyFailFast  = "failfast"
+)
+
+const (
+	fileErrNotFound   = "notFound"
+	fileErrPermission = "permission"
+	fileErrNetwork    = "network"
+	fileErrWrite      = "write"
+	fileErrOther      = "other"
+)
+
+// fileErrClasses lists the file copy error classes in their summary order.
+var fileErrClasses = []string{fileErrNotFound, fileErrPermission, fileErrNetwork, fileErrWrite, fileErrOther}
+
+// fileWriteError wraps a v3 storage upload error.
+type fileWriteError struct {
+	err error
+}
+
+func (e *fileWriteError) Error() string {
+	return "write failure: " + e.err.Error()
+}
+
+func (e *fileWriteError) Unwrap() error {
+	return e.err
+}
+
+// classifyFileError returns the class of the provided file copy error.
+func classifyFileError(err error) string {
+	if errors.Is(err, filesystem.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return fileErrNotFound
+	}
+
+	if errors.Is(err, fs.ErrPermission) {
+		return fileErrPermission
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.PermissionDenied:
+		return fileErrPermission
+	case gcerrors.DeadlineExceeded:
+		return fileErrNetwork
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		switch statusErr.HTTPStatusCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fileErrPermission
+		case http.StatusNotFound:
+			return fileErrNotFound
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return fileErrNetwork
+	}
+
+	var writeErr *fileWriteError
+	if errors.As(err, &writeErr) {
+		return fileErrWrite
+	}
+
+	return fileErrOther
+}
+
+// fileCopyStats holds the file copy counters of a single migration run.
+type fileCopyStats struct {
+	mu       sync.Mutex
+	copied   int
+	failures map[string]int
+
+	// pending is the number of failed files that are queued for retry
+	pending int
+}
+
+func (s *fileCopyStats) addCopied(recovered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.copied++
+	if recovered {
+		s.pending--
+	}
+}
+
+func (s *fileCopyStats) addPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending++
+}
+
+func (s *fileCopyStats) addFailure(class string, retried bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures == nil {
+		s.failures = map[string]int{}
+	}
+	s.failures[class]++
+
+	if retried {
+		s.pending--
+	}
+}
+
+// errorRate returns the ratio of the failed files and the total number of finished
+// (copied or failed) files.
+//
+// The pending files are excluded because they could still recover on retry.
+func (s *fileCopyStats) errorRate() (float64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failed int
+	for _, n := range s.failures {
+		failed += n
+	}
+
+	total := s.copied + failed
+	if total == 0 {
+		return 0, 0
+	}
+
+	return float64(failed) / float64(total), total
+}
+
+// report logs the file copy summary with the failures count per error class.
+func (s *fileCopyStats) report(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := []any{"copied", s.copied}
+
+	var failed int
+	for _, class := range fileErrClasses {
+		attrs = append(attrs, class, s.failures[class])
+		failed += s.failures[class]
+	}
+	attrs = append(attrs, "failed", failed)
+
+	logger.Info("File copy summary", attrs...)
+}
+
+// handleFileCopyError applies the configured file copy policy to a failed file copy.
+//
+// Returns a non-nil error if the migration should be stopped.
+func (m *Migrator) handleFileCopyError(f failedFile, err error, retried bool) error {
+	class := classifyFileError(err)
+
+	policy := m.config.FileCopyPolicy
+	if policy == "" {
+		policy = fileCopyTolerant
+	}
+
+	fatal := policy == fileCopyFailFast || (policy == fileCopyMissing && class != fileErrNotFound)
+
+	// queue the (potentially transient) failures for one more retry at the end of the run
+	if !retried && !fatal && class != fileErrNotFound {
+		m.logger.Debug("Queued failed file for retry", "step", f.Step, "fileKey", f.OldKey, "newFileKey", f.NewKey, "errorClass", class, "error", err)
+		m.fileStats.addPending()
+		m.failedFiles.add(f)
+		return nil
+	}
+
+	m.fileStats.addFailure(class, retried)
+
+	m.logger.Warn("Failed to copy file", "step", f.Step, "fileKey", f.OldKey, "newFileKey", f.NewKey, "errorClass", class, "error", err)
+
+	if fatal {
+		return fmt.Errorf("failed to copy file %q (%s, fileCopyPolicy %q): %w", f.OldKey, class, policy, err)
+	}
+
+	return nil
+}
+
+// minFileErrorRateSample is the min number of finished files
+// before the file copy error rate is checked during the migration.
+const minFileErrorRateSample = 100
+
+// checkFileErrorRate returns an error if the "threshold" file copy policy
+// is used and the current file copy error rate exceeds the configured threshold.
+//
+// It is checked after each step (only if there are enough finished files
+// for a meaningful rate) and at the end of the run after the file retries (final).
+func (m *Migrator) checkFileErrorRate(final bool) error {
+	if m.config.FileCopyPolicy != fileCopyThreshold {
+		return nil
+	}
+
+	rate, total := m.fileStats.errorRate()
+	if !final && total < minFileErrorRateSample {
+		return nil
+	}
+
+	if rate > m.config.FileCopyErrorThreshold {
+		return fmt.Errorf("file copy error rate %.2f%% exceeds the fileCopyErrorThreshold %.2f%%", rate*100, m.config.FileCopyErrorThreshold*100)
+	}
+
+	return nil
+}
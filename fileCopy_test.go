@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+func TestClassifyFileError(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"filesystem not found", filesystem.ErrNotFound, fileErrNotFound},
+		{"wrapped fs not exist", fmt.Errorf("read: %w", fs.ErrNotExist), fileErrNotFound},
+		{"fs permission", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrPermission}, fileErrPermission},
+		{"http 401", &httpStatusError{Status: "401 Unauthorized", Code: http.StatusUnauthorized}, fileErrPermission},
+		{"http 403", &httpStatusError{Status: "403 Forbidden", Code: http.StatusForbidden}, fileErrPermission},
+		{"http 404", &httpStatusError{Status: "404 Not Found", Code: http.StatusNotFound}, fileErrNotFound},
+		{"http 500", &httpStatusError{Status: "500 Internal Server Error", Code: http.StatusInternalServerError}, fileErrOther},
+		{"net error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, fileErrNetwork},
+		{"deadline exceeded", fmt.Errorf("get: %w", context.DeadlineExceeded), fileErrNetwork},
+		{"write error", &fileWriteError{err: errors.New("disk full")}, fileErrWrite},
+		{"other", errors.New("unknown"), fileErrOther},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if class := classifyFileError(s.err); class != s.expected {
+				t.Fatalf("expected class %q, got %q", s.expected, class)
+			}
+		})
+	}
+}
+
+func TestCheckFileErrorRate(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		policy      string
+		copied      int
+		failed      int
+		pending     int
+		final       bool
+		expectError bool
+	}{
+		{"non threshold policy", fileCopyTolerant, 0, 10, 0, true, false},
+		{"no files", fileCopyThreshold, 0, 0, 0, true, false},
+		{"small sample during the run", fileCopyThreshold, 1, 1, 0, false, false},
+		{"small sample at the end", fileCopyThreshold, 1, 1, 0, true, true},
+		{"large sample during the run", fileCopyThreshold, 90, 10, 0, false, true},
+		{"pending retries are not failures", fileCopyThreshold, 100, 0, 50, false, false},
+		{"within the threshold", fileCopyThreshold, 95, 5, 0, true, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			m := &Migrator{
+				config:    &Config{FileCopyPolicy: s.policy, FileCopyErrorThreshold: 0.05},
+				fileStats: &fileCopyStats{},
+			}
+
+			for i := 0; i < s.copied; i++ {
+				m.fileStats.addCopied(false)
+			}
+			for i := 0; i < s.failed; i++ {
+				m.fileStats.addFailure(fileErrOther, false)
+			}
+			for i := 0; i < s.pending; i++ {
+				m.fileStats.addPending()
+			}
+
+			err := m.checkFileErrorRate(s.final)
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+		})
+	}
+}
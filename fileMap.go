@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const fileMapCollectionName = "_migrationFileMap"
+
+// saveFileMapping persists the v2 storage file key -> v3 record file field mapping
+// (it is used by the redirect server to resolve the v2 file urls).
+func (m *Migrator) saveFileMapping(record *core.Record, field string, v2Key string) {
+	err := m.pbApp.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().Delete(fileMapCollectionName, dbx.HashExp{
+			"source": m.idPrefix(),
+			"v2Key":  v2Key,
+		}).Execute()
+		if err != nil {
+			return err
+		}
+
+		_, err = txApp.DB().Insert(fileMapCollectionName, dbx.Params{
+			"id":           core.GenerateDefaultRandomId(),
+			"source":       m.idPrefix(),
+			"v2Key":        v2Key,
+			"v3Collection": record.Collection().Name,
+			"v3Id":         record.Id,
+			"v3Field":      field,
+		}).Execute()
+
+		return err
+	})
+	if err != nil {
+		// the file is still migrated, only its v2 url can't be redirected by the redirect server
+		m.logger.Error("Failed to persist the v2 to v3 file mapping", "step", record.Collection().Name, "v3Id", record.Id, "fileKey", v2Key, "error", err)
+	}
+}
+
+func (m *Migrator) ensureFileMapCollection() error {
+	collection, _ := m.pbApp.FindCollectionByNameOrId(fileMapCollectionName)
+	if collection != nil {
+		return nil
+	}
+
+	collection = core.NewBaseCollection(fileMapCollectionName)
+	collection.System = true
+	collection.Fields.Add(
+		&core.TextField{Name: "source"},
+		&core.TextField{Name: "v2Key"},
+		&core.TextField{Name: "v3Collection"},
+		&core.TextField{Name: "v3Id"},
+		&core.TextField{Name: "v3Field"},
+	)
+	collection.AddIndex("idx_migrationFileMap_v2", true, "`source`, `v2Key`", "")
+
+	return m.pbApp.Save(collection)
+}
@@ -13,6 +13,9 @@ func (m *Migrator) MigrateHotspotTemplates() error {
 		return err
 	}
 
+	progress := m.startProgress("hotspotTemplates", "HotspotTemplate")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -22,16 +25,31 @@ func (m *Migrator) MigrateHotspotTemplates() error {
 		q := m.oldDB.Select("*").
 			From("HotspotTemplate").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("HotspotTemplate")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			prototypeId, skip, err := m.resolveRef(refTemplatePrototype, "Prototype", item.PrototypeId)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue // dangling reference
+			}
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			insertedIds = append(insertedIds, m.buildRecordId("HotspotTemplate", item.baseModel))
+
+			record := m.initRecordToMigrate(collection, "HotspotTemplate", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -42,11 +60,14 @@ func (m *Migrator) MigrateHotspotTemplates() error {
 			updatedAt, _ := types.ParseDateTime(item.UpdatedAt)
 			record.SetRaw("updated", updatedAt)
 
-			record.Set("prototype", fmt.Sprintf("%s%d", v2Prefix, item.PrototypeId))
+			record.Set("prototype", prototypeId)
 
 			screenIds, err := m.getPrefixedTemplateScreenIds(item.Id)
 			if err != nil {
-				return fmt.Errorf("failed to fetch template screens: %w", err)
+				if err := m.quarantineRow("hotspotTemplates", "HotspotTemplate", item.Id, item, fmt.Errorf("failed to fetch template screens: %w", err)); err != nil {
+					return err
+				}
+				continue
 			}
 			record.Set("screens", screenIds)
 
@@ -66,8 +87,10 @@ func (m *Migrator) MigrateHotspotTemplates() error {
 				}
 			}
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("hotspotTemplates", "HotspotTemplate", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -88,18 +111,28 @@ func (m *Migrator) MigrateHotspotTemplates() error {
 func (m *Migrator) getPrefixedTemplateScreenIds(templateId int) ([]string, error) {
 	var ids []int
 
-	err := m.oldDB.Select("screenId").
-		From("HotspotTemplateScreenRel").
-		AndWhere(dbx.HashExp{"hotspotTemplateId": templateId}).
-		Column(&ids)
+	err := m.retry("v2 relation query", func() error {
+		ids = nil
+		return m.oldDB.Select("screenId").
+			From("HotspotTemplateScreenRel").
+			AndWhere(dbx.HashExp{"hotspotTemplateId": templateId}).
+			Column(&ids)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]string, len(ids))
+	result := make([]string, 0, len(ids))
 
-	for i, id := range ids {
-		result[i] = fmt.Sprintf("%s%d", v2Prefix, id)
+	for _, id := range ids {
+		// for the relation rows both drop and null remove only the dangling id
+		screenId, _, err := m.resolveRef(refTemplateScreen, "Screen", id)
+		if err != nil {
+			return nil, err
+		}
+		if screenId != "" {
+			result = append(result, screenId)
+		}
 	}
 
 	return result, nil
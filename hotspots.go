@@ -14,6 +14,9 @@ func (m *Migrator) MigrateHotspots() error {
 		return err
 	}
 
+	progress := m.startProgress("hotspots", "Hotspot")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -23,16 +26,45 @@ func (m *Migrator) MigrateHotspots() error {
 		q := m.oldDB.Select("*").
 			From("Hotspot").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("Hotspot")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			var screenId, templateId string
+			var skip bool
+			var err error
+
+			if item.ScreenId != nil {
+				screenId, skip, err = m.resolveRef(refHotspotScreen, "Screen", *item.ScreenId)
+				if err != nil {
+					return err
+				}
+			}
+
+			if item.HotspotTemplateId != nil && !skip {
+				templateId, skip, err = m.resolveRef(refHotspotTemplate, "HotspotTemplate", *item.HotspotTemplateId)
+				if err != nil {
+					return err
+				}
+			}
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			if skip || m.integrity.shouldDrop(refHotspotSettingScreen, item.Id) {
+				continue // dangling reference
+			}
+
+			insertedIds = append(insertedIds, m.buildRecordId("Hotspot", item.baseModel))
+
+			record := m.initRecordToMigrate(collection, "Hotspot", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -49,34 +81,45 @@ func (m *Migrator) MigrateHotspots() error {
 			record.Set("height", item.Height)
 			record.Set("type", item.Type)
 
-			if item.ScreenId != nil {
-				record.Set("screen", fmt.Sprintf("%s%d", v2Prefix, *item.ScreenId))
-			}
-
-			if item.HotspotTemplateId != nil {
-				record.Set("hotspotTemplate", fmt.Sprintf("%s%d", v2Prefix, *item.HotspotTemplateId))
-			}
+			record.Set("screen", screenId)
+			record.Set("hotspotTemplate", templateId)
 
 			if item.Settings != nil && *item.Settings != "" {
 				settings := map[string]any{}
 				if err := json.Unmarshal([]byte(*item.Settings), &settings); err != nil {
-					return fmt.Errorf("failed to read hotspot %q settings: %w", item.Id, err)
+					if err := m.quarantineRow("hotspots", "Hotspot", item.Id, item, fmt.Errorf("failed to read hotspot %q settings: %w", item.Id, err)); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if cast.ToString(settings["transition"]) == "none" {
 					settings["transition"] = ""
 				}
 
-				if screenId := cast.ToString(settings["screenId"]); screenId != "" {
+				if v2ScreenId := cast.ToString(settings["screenId"]); v2ScreenId != "" {
 					delete(settings, "screenId")
-					settings["screen"] = fmt.Sprintf("%s%s", v2Prefix, screenId)
+					if !m.integrity.isDangling(refHotspotSettingScreen, item.Id) {
+						settingsScreenId, skip, err := m.lookupRef(refHotspotSettingScreen, "Screen", cast.ToInt(v2ScreenId))
+						if err != nil {
+							return err
+						}
+						if skip {
+							continue // not migrated settings screen
+						}
+						if settingsScreenId != "" {
+							settings["screen"] = settingsScreenId
+						}
+					}
 				}
 
 				record.Set("settings", settings)
 			}
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("hotspots", "Hotspot", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const idMapCollectionName = "_migrationIdMap"
+
+// v2TableIdPrefixes lists the extra id prefixes of the v2 tables
+// (used only when opaqueIds is disabled).
+var v2TableIdPrefixes = map[string]string{
+	"ProjectLink": "link",
+}
+
+// idMap holds the persisted v2 table+id -> v3 id mapping of the current source.
+type idMap struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func idMapKey(table string, v2Id int) string {
+	return table + ":" + strconv.Itoa(v2Id)
+}
+
+// buildRecordId constructs the Record id of the provided v2 table row that is being migrated.
+//
+// By default the id is the source prefix followed by the v2 id (eg. "pr2_123").
+// With opaqueIds a random PocketBase-style id is generated on first access
+// and persisted in the [idMapCollectionName] collection.
+//
+// The references to other v2 rows should be resolved with [Migrator.findRecordId]
+// so that only the actually migrated rows get an id mapping.
+func (m *Migrator) buildRecordId(table string, item baseModel) string {
+	return m.generateRecordId(table, item.Id)
+}
+
+func (m *Migrator) generateRecordId(table string, v2Id int) string {
+	if m.idMap == nil {
+		return m.idPrefix() + v2TableIdPrefixes[table] + strconv.Itoa(v2Id)
+	}
+
+	key := idMapKey(table, v2Id)
+
+	m.idMap.mu.Lock()
+	if id, ok := m.idMap.ids[key]; ok {
+		m.idMap.mu.Unlock()
+		return id
+	}
+	id := security.RandomStringWithAlphabet(core.DefaultIdLength, core.DefaultIdAlphabet)
+	m.idMap.ids[key] = id
+	m.idMap.mu.Unlock()
+
+	// persisted outside of the lock so that the other step workers are not blocked
+	_, err := m.pbApp.DB().Insert(idMapCollectionName, dbx.Params{
+		"id":      core.GenerateDefaultRandomId(),
+		"source":  m.idPrefix(),
+		"v2Table": table,
+		"v2Id":    v2Id,
+		"v3Id":    id,
+	}).Execute()
+	if err != nil {
+		// the next run will generate a new id for the same v2 row
+		m.logger.Error("Failed to persist the v2 to v3 id mapping", "step", table, "v2Id", v2Id, "v3Id", id, "error", err)
+	}
+
+	return id
+}
+
+// findRecordId returns the v3 record id of the specified v2 table row
+// and reports whether it is known (it never generates a new opaque id).
+func (m *Migrator) findRecordId(table string, v2Id int) (string, bool) {
+	if m.idMap == nil {
+		return m.idPrefix() + v2TableIdPrefixes[table] + strconv.Itoa(v2Id), true
+	}
+
+	m.idMap.mu.Lock()
+	defer m.idMap.mu.Unlock()
+
+	id, ok := m.idMap.ids[idMapKey(table, v2Id)]
+
+	return id, ok
+}
+
+// loadIdMap loads the persisted id mapping of the current source
+// if opaqueIds is enabled (see [Migrator.buildRecordId]).
+func (m *Migrator) loadIdMap() error {
+	m.idMap = nil
+
+	if err := m.ensureIdMapCollection(); err != nil {
+		return fmt.Errorf("failed to create the %s collection: %w", idMapCollectionName, err)
+	}
+
+	rows := []struct {
+		V2Table string `db:"v2Table"`
+		V2Id    int    `db:"v2Id"`
+		V3Id    string `db:"v3Id"`
+	}{}
+
+	err := m.pbApp.DB().Select("v2Table", "v2Id", "v3Id").
+		From(idMapCollectionName).
+		AndWhere(dbx.HashExp{"source": m.idPrefix()}).
+		All(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to load the v2 to v3 id mapping: %w", err)
+	}
+
+	if !m.config.OpaqueIds {
+		if len(rows) > 0 {
+			return fmt.Errorf("the previous runs of source %q used opaqueIds and it can't be disabled", m.idPrefix())
+		}
+		return nil
+	}
+
+	// the records of a source can't be mixed with prefixed and opaque ids
+	// (the already migrated rows would be duplicated)
+	if len(rows) == 0 {
+		prefixed, err := m.hasPrefixedRecords()
+		if err != nil {
+			return fmt.Errorf("failed to check for existing %q records: %w", m.idPrefix(), err)
+		}
+		if prefixed {
+			return fmt.Errorf("the previous runs of source %q didn't use opaqueIds and it can't be enabled", m.idPrefix())
+		}
+	}
+
+	m.idMap = &idMap{ids: make(map[string]string, len(rows))}
+	for _, row := range rows {
+		m.idMap.ids[idMapKey(row.V2Table, row.V2Id)] = row.V3Id
+	}
+
+	m.logger.Debug("Loaded v2 to v3 id mapping", "source", m.idPrefix(), "ids", len(rows))
+
+	return nil
+}
+
+// sourceRecordsExp returns an expression that matches only the records
+// migrated from the current source.
+func (m *Migrator) sourceRecordsExp() dbx.Expression {
+	if m.idMap != nil {
+		return dbx.NewExp(
+			"[[id]] IN (SELECT [[v3Id]] FROM {{"+idMapCollectionName+"}} WHERE [[source]] = {:source})",
+			dbx.Params{"source": m.idPrefix()},
+		)
+	}
+
+	return m.prefixedIdsExp()
+}
+
+// prefixedIdsExp returns an expression that matches only the ids
+// starting with the prefix of the current source.
+func (m *Migrator) prefixedIdsExp() dbx.Expression {
+	return dbx.NewExp("substr([[id]], 1, {:prefixLength}) = {:prefix}", dbx.Params{
+		"prefix":       m.idPrefix(),
+		"prefixLength": len(m.idPrefix()),
+	})
+}
+
+// hasPrefixedRecords reports whether any of the [v3Schema] collections
+// has records with the prefixed ids of the current source.
+func (m *Migrator) hasPrefixedRecords() (bool, error) {
+	for _, sc := range v3Schema {
+		collection, err := m.pbApp.FindCollectionByNameOrId(sc.Name)
+		if err != nil {
+			continue // reported by the preflight
+		}
+
+		var exists bool
+		err = m.pbApp.DB().Select("(1)").
+			From(collection.Name).
+			AndWhere(m.prefixedIdsExp()).
+			// opaque ids of other sources that happen to start with the prefix
+			AndWhere(dbx.NewExp("[[id]] NOT IN (SELECT [[v3Id]] FROM {{" + idMapCollectionName + "}})")).
+			Limit(1).
+			Row(&exists)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *Migrator) ensureIdMapCollection() error {
+	collection, _ := m.pbApp.FindCollectionByNameOrId(idMapCollectionName)
+	if collection != nil {
+		return nil
+	}
+
+	collection = core.NewBaseCollection(idMapCollectionName)
+	collection.System = true
+	collection.Fields.Add(
+		&core.TextField{Name: "source"},
+		&core.TextField{Name: "v2Table"},
+		&core.NumberField{Name: "v2Id", OnlyInt: true},
+		&core.TextField{Name: "v3Id"},
+	)
+	collection.AddIndex("idx_migrationIdMap_v2", true, "`source`, `v2Table`, `v2Id`", "")
+	collection.AddIndex("idx_migrationIdMap_v3", false, "`v3Id`", "")
+
+	return m.pbApp.Save(collection)
+}
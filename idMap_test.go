@@ -0,0 +1,131 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestLoadIdMapOpaqueIdsSwitch(t *testing.T) {
+	app := newTestApp(t)
+
+	config := newTestConfig(t, app)
+
+	m := newTestMigrator(t, app, config)
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// enabling opaqueIds for an already migrated source
+	config.OpaqueIds = true
+	err := m.loadIdMap()
+	if err == nil || !strings.Contains(err.Error(), "can't be enabled") {
+		t.Fatalf("expected opaqueIds enable error, got %v", err)
+	}
+
+	// a new source is not affected
+	config.IdPrefix = "new_"
+	if err := m.loadIdMap(); err != nil {
+		t.Fatalf("expected nil error for a new source, got %v", err)
+	}
+	if m.idMap == nil {
+		t.Fatal("expected loaded id map")
+	}
+}
+
+func TestOpaqueIdsReferences(t *testing.T) {
+	app := newTestApp(t)
+
+	config := newTestConfig(t, app)
+	config.OpaqueIds = true
+
+	m := newTestMigrator(t, app, config)
+
+	// orphan chain: missing project 99 <- prototype 5 <- screen 7
+	rows := []struct {
+		table  string
+		params dbx.Params
+	}{
+		{"Prototype", dbx.Params{"id": 5, "projectId": 99, "title": "Orphan", "type": "desktop", "width": 0, "height": 0, "scaleFactor": 1}},
+		{"Screen", dbx.Params{"id": 7, "prototypeId": 5, "order": 1, "title": "Orphan", "alignment": "center", "background": "#ffffff", "fixedHeader": 0, "fixedFooter": 0, "filePath": "projects/99/a.png"}},
+	}
+	for _, row := range rows {
+		if _, err := m.oldDB.Insert(row.table, row.params).Execute(); err != nil {
+			t.Fatalf("failed to insert %s row: %v", row.table, err)
+		}
+	}
+
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []struct {
+		table string
+		v2Id  int
+	}{{"Project", 99}, {"Prototype", 5}, {"Screen", 7}} {
+		if id, ok := m.findRecordId(ref.table, ref.v2Id); ok {
+			t.Errorf("expected no id mapping for the not migrated %s %d, got %q", ref.table, ref.v2Id, id)
+		}
+	}
+
+	mustFindId := func(table string, v2Id int) string {
+		id, ok := m.findRecordId(table, v2Id)
+		if !ok {
+			t.Fatalf("missing id mapping for %s %d", table, v2Id)
+		}
+		return id
+	}
+
+	prototype, err := app.FindRecordById("prototypes", mustFindId("Prototype", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOrder := []string{mustFindId("Screen", 2), mustFindId("Screen", 1)}
+	if order := prototype.GetStringSlice("screensOrder"); !slices.Equal(order, expectedOrder) {
+		t.Errorf("expected screensOrder %v, got %v", expectedOrder, order)
+	}
+
+	reply, err := app.FindRecordById("comments", mustFindId("ScreenComment", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := reply.GetString("replyTo"); v != mustFindId("ScreenComment", 1) {
+		t.Errorf("expected replyTo %q, got %q", mustFindId("ScreenComment", 1), v)
+	}
+	if v := reply.GetString("screen"); v != mustFindId("Screen", 1) {
+		t.Errorf("expected screen %q, got %q", mustFindId("Screen", 1), v)
+	}
+
+	hotspot, err := app.FindRecordById("hotspots", mustFindId("Hotspot", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := map[string]any{}
+	if err := hotspot.UnmarshalJSONField("settings", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if v := settings["screen"]; v != mustFindId("Screen", 2) {
+		t.Errorf("expected settings screen %q, got %v", mustFindId("Screen", 2), v)
+	}
+
+	total, err := app.CountRecords(idMapCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// incremental run with the same data
+	m = newTestMigrator(t, app, config)
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	rerunTotal, err := app.CountRecords(idMapCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rerunTotal != total {
+		t.Errorf("expected %d id mappings after the rerun, got %d", total, rerunTotal)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/sync/errgroup"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxScreenImageSize is the max allowed width and height of a screen image.
+const maxScreenImageSize = 30000
+
+// Screen image normalization actions.
+const (
+	imageConverted = "converted"
+	imageRenamed   = "renamed"
+)
+
+// imageMimeExtensions lists the known file extensions of the image MIME types
+// (the first one is used when the extension has to be fixed).
+var imageMimeExtensions = map[string][]string{
+	"image/png":     {".png"},
+	"image/jpeg":    {".jpg", ".jpeg"},
+	"image/gif":     {".gif"},
+	"image/webp":    {".webp"},
+	"image/bmp":     {".bmp"},
+	"image/tiff":    {".tiff", ".tif"},
+	"image/svg+xml": {".svg"},
+}
+
+// defaultScreenMimeTypes are the screen image MIME types that are kept as they are
+// when the v3 screens file field doesn't restrict them.
+var defaultScreenMimeTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "image/svg+xml"}
+
+// screenImage holds a single screen image to copy.
+type screenImage struct {
+	Record *core.Record
+	OldKey string
+}
+
+// imageStats holds the screen image validation counters of a single migration run.
+type imageStats struct {
+	mu        sync.Mutex
+	checked   int
+	converted int
+	renamed   int
+	corrupt   int
+}
+
+func (s *imageStats) add(action string, corrupt bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checked++
+
+	switch {
+	case corrupt:
+		s.corrupt++
+	case action == imageConverted:
+		s.converted++
+	case action == imageRenamed:
+		s.renamed++
+	}
+}
+
+// report logs the screen image validation summary.
+func (s *imageStats) report(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logger.Info(
+		"Image validation summary",
+		"checked", s.checked,
+		"converted", s.converted,
+		"renamed", s.renamed,
+		"corrupt", s.corrupt,
+	)
+}
+
+// batchCopyScreenImages is similar to [Migrator.batchCopyFiles] but it also validates
+// and normalizes each screen image before its upload (see [normalizeScreenImage]).
+//
+// The corrupt images are reported per screen and copied as they are.
+// When the image is converted or its extension is fixed, the screen file field is updated accordingly.
+func (m *Migrator) batchCopyScreenImages(collection *core.Collection, images []screenImage, batchSize int) error {
+	allowed := defaultScreenMimeTypes
+	if field, ok := collection.Fields.GetByName("file").(*core.FileField); ok && len(field.MimeTypes) > 0 {
+		allowed = field.MimeTypes
+	}
+
+	var copyGroup errgroup.Group
+
+	copyGroup.SetLimit(batchSize)
+
+	for _, img := range images {
+		img := img
+		copyGroup.Go(func() error {
+			name := img.Record.GetString("file")
+
+			// the final retry of the failed files copies them as they are
+			// so they are always queued with the original file name
+			failed := failedFile{Step: "screens", OldKey: img.OldKey, NewKey: img.Record.BaseFilesPath() + "/" + name}
+
+			data, err := m.readOldFile(img.OldKey)
+			if err != nil {
+				return m.handleFileCopyError(failed, err, false)
+			}
+
+			data, newName, action, err := normalizeScreenImage(data, name, allowed)
+			m.imageStats.add(action, err != nil)
+			if err != nil {
+				m.logger.Warn("Corrupt screen image", "step", "screens", "v3Id", img.Record.Id, "fileKey", img.OldKey, "error", err)
+			}
+
+			newKey := img.Record.BaseFilesPath() + "/" + newName
+			if err := m.uploadNewFile(data, newKey); err != nil {
+				return m.handleFileCopyError(failed, err, false)
+			}
+
+			m.fileStats.addCopied(false)
+			m.logger.Debug("Copied file", "step", "screens", "fileKey", img.OldKey, "newFileKey", newKey)
+
+			if newName == name {
+				return nil
+			}
+
+			// direct update to preserve the record "updated" date used for the incremental runs
+			_, err = m.pbApp.DB().Update(
+				collection.Name,
+				dbx.Params{"file": newName},
+				dbx.HashExp{"id": img.Record.Id},
+			).Execute()
+			if err != nil {
+				return fmt.Errorf("failed to update the file of screen %q: %w", img.Record.Id, err)
+			}
+
+			m.logger.Info("Normalized screen image", "step", "screens", "v3Id", img.Record.Id, "action", action, "file", name, "newFile", newName)
+
+			return nil
+		})
+	}
+
+	return copyGroup.Wait()
+}
+
+// normalizeScreenImage decodes the image data, checks its dimensions and detects its real MIME type.
+//
+// Images with MIME type that is not in the allowed list are converted to PNG
+// and images with extension that doesn't match their content are renamed.
+// The returned action is empty if the image is kept as it is.
+//
+// Returns an error if the image is corrupt (the original data and name are returned with it).
+func normalizeScreenImage(data []byte, name string, allowed []string) ([]byte, string, string, error) {
+	mimeType, _, _ := strings.Cut(mimetype.Detect(data).String(), ";")
+
+	var img image.Image
+
+	// SVG can't be decoded so only its extension is checked
+	if mimeType != "image/svg+xml" {
+		// check the dimensions before allocating the full image
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return data, name, "", fmt.Errorf("failed to decode %s image header: %w", mimeType, err)
+		}
+		if config.Width <= 0 || config.Height <= 0 || config.Width > maxScreenImageSize || config.Height > maxScreenImageSize {
+			return data, name, "", fmt.Errorf("invalid image dimensions %dx%d", config.Width, config.Height)
+		}
+
+		// the full decode detects also the truncated uploads
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return data, name, "", fmt.Errorf("failed to decode %s image: %w", mimeType, err)
+		}
+
+		mimeType = "image/" + format
+	}
+
+	if !slices.Contains(allowed, mimeType) {
+		if img == nil {
+			return data, name, "", fmt.Errorf("unsupported %s image", mimeType)
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return data, name, "", fmt.Errorf("failed to convert %s image to png: %w", mimeType, err)
+		}
+
+		return buf.Bytes(), replaceExt(name, ".png"), imageConverted, nil
+	}
+
+	exts := imageMimeExtensions[mimeType]
+	if len(exts) > 0 && !slices.Contains(exts, strings.ToLower(path.Ext(name))) {
+		return data, replaceExt(name, exts[0]), imageRenamed, nil
+	}
+
+	return data, name, "", nil
+}
+
+// replaceExt replaces the extension of the file name.
+func replaceExt(name string, ext string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + ext
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestNormalizeScreenImage(t *testing.T) {
+	pngData := testPNG(t, 10, 5)
+
+	var jpegBuf bytes.Buffer
+	if err := jpeg.Encode(&jpegBuf, image.NewRGBA(image.Rect(0, 0, 10, 5)), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpegData := jpegBuf.Bytes()
+
+	var bmpBuf bytes.Buffer
+	if err := bmp.Encode(&bmpBuf, image.NewRGBA(image.Rect(0, 0, 10, 5))); err != nil {
+		t.Fatal(err)
+	}
+	bmpData := bmpBuf.Bytes()
+
+	svgData := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="5"></svg>`)
+
+	scenarios := []struct {
+		name           string
+		data           []byte
+		fileName       string
+		allowed        []string
+		expectedName   string
+		expectedAction string
+		expectedPNG    bool // whether the returned data should be a converted png
+		expectError    bool
+	}{
+		{"valid png", pngData, "a.png", defaultScreenMimeTypes, "a.png", "", false, false},
+		{"valid jpeg with uppercase ext", jpegData, "a.JPEG", defaultScreenMimeTypes, "a.JPEG", "", false, false},
+		{"png with wrong ext", pngData, "a.jpg", defaultScreenMimeTypes, "a.png", imageRenamed, false, false},
+		{"png without ext", pngData, "a", defaultScreenMimeTypes, "a.png", imageRenamed, false, false},
+		{"disallowed bmp", bmpData, "a.bmp", defaultScreenMimeTypes, "a.png", imageConverted, true, false},
+		{"disallowed jpeg", jpegData, "a.jpg", []string{"image/png"}, "a.png", imageConverted, true, false},
+		{"valid svg", svgData, "a.svg", defaultScreenMimeTypes, "a.svg", "", false, false},
+		{"svg with wrong ext", svgData, "a.png", defaultScreenMimeTypes, "a.svg", imageRenamed, false, false},
+		{"disallowed svg", svgData, "a.svg", []string{"image/png"}, "a.svg", "", false, true},
+		{"truncated png", pngData[:len(pngData)-20], "a.png", defaultScreenMimeTypes, "a.png", "", false, true},
+		{"not an image", []byte("lorem ipsum"), "a.png", defaultScreenMimeTypes, "a.png", "", false, true},
+		{"oversized width", testPNG(t, maxScreenImageSize+1, 1), "a.png", defaultScreenMimeTypes, "a.png", "", false, true},
+		{"oversized height", testPNG(t, 1, maxScreenImageSize+1), "a.png", defaultScreenMimeTypes, "a.png", "", false, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			data, name, action, err := normalizeScreenImage(s.data, s.fileName, s.allowed)
+
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if name != s.expectedName {
+				t.Fatalf("expected name %q, got %q", s.expectedName, name)
+			}
+
+			if action != s.expectedAction {
+				t.Fatalf("expected action %q, got %q", s.expectedAction, action)
+			}
+
+			if !s.expectedPNG {
+				if !bytes.Equal(data, s.data) {
+					t.Fatal("expected the original data to be returned")
+				}
+				return
+			}
+
+			img, format, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to decode the converted image: %v", err)
+			}
+			if format != "png" {
+				t.Fatalf("expected png format, got %q", format)
+			}
+			if size := img.Bounds().Size(); size.X != 10 || size.Y != 5 {
+				t.Fatalf("expected 10x5 image, got %v", size)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/spf13/cast"
+)
+
+const (
+	danglingDrop = "drop"
+	danglingNull = "null"
+	danglingFail = "fail"
+)
+
+const (
+	refPrototypeProject     = "prototypeProject"
+	refScreenPrototype      = "screenPrototype"
+	refCommentScreen        = "commentScreen"
+	refCommentReplyTo       = "commentReplyTo"
+	refTemplatePrototype    = "templatePrototype"
+	refTemplateScreen       = "templateScreen"
+	refHotspotScreen        = "hotspotScreen"
+	refHotspotTemplate      = "hotspotTemplate"
+	refHotspotSettingScreen = "hotspotSettingsScreen"
+	refLinkProject          = "linkProject"
+	refLinkPrototype        = "linkPrototype"
+	refProjectUser          = "projectUser"
+	refProjectUserProject   = "projectUserProject"
+	refNotificationUser     = "notificationUser"
+	refNotificationComment  = "notificationComment"
+	refOAuth2User           = "oauth2User"
+)
+
+// danglingRef describes a single v2 foreign key that could point to a missing row.
+type danglingRef struct {
+	Kind     string
+	Table    string
+	Column   string
+	RefTable string
+
+	// DefaultPolicy is the policy used if not overwritten with Config.DanglingRefs.
+	DefaultPolicy string
+}
+
+// danglingRefs lists all v2 foreign keys checked by the integrity checker.
+//
+// The refs are in dependency order (the parent tables first) because
+// a reference to a row that is dropped by a previous ref is also dangling
+// (eg. the screens of a dropped prototype are dropped too).
+//
+// Note that for the relation tables (eg. HotspotTemplateScreenRel)
+// the "drop" and "null" policies have the same effect - the dangling
+// id is removed from the v3 multiple relation field.
+var danglingRefs = []danglingRef{
+	{refPrototypeProject, "Prototype", "projectId", "Project", danglingDrop},
+	{refScreenPrototype, "Screen", "prototypeId", "Prototype", danglingDrop},
+	{refCommentScreen, "ScreenComment", "screenId", "Screen", danglingDrop},
+	{refCommentReplyTo, "ScreenComment", "replyTo", "ScreenComment", danglingNull},
+	{refTemplatePrototype, "HotspotTemplate", "prototypeId", "Prototype", danglingDrop},
+	{refTemplateScreen, "HotspotTemplateScreenRel", "screenId", "Screen", danglingDrop},
+	{refHotspotScreen, "Hotspot", "screenId", "Screen", danglingDrop},
+	{refHotspotTemplate, "Hotspot", "hotspotTemplateId", "HotspotTemplate", danglingDrop},
+	{refLinkProject, "ProjectLink", "projectId", "Project", danglingDrop},
+	{refLinkPrototype, "ProjectLinkPrototypeRel", "prototypeId", "Prototype", danglingDrop},
+	{refProjectUser, "UserProjectRel", "userId", "User", danglingDrop},
+	{refProjectUserProject, "UserProjectRel", "projectId", "Project", danglingDrop},
+	{refNotificationUser, "UserScreenCommentRel", "userId", "User", danglingDrop},
+	{refNotificationComment, "UserScreenCommentRel", "screenCommentId", "ScreenComment", danglingDrop},
+	{refOAuth2User, "UserAuth", "userId", "User", danglingDrop},
+
+	// the hotspot settings.screenId is stored as json so it is checked separately;
+	// it is also considered dangling if it points to a screen from another prototype
+	{refHotspotSettingScreen, "Hotspot", "settings", "Screen", danglingNull},
+}
+
+// integrityCheck holds the dangling v2 references found by [Migrator.CheckIntegrity].
+type integrityCheck struct {
+	policies map[string]string
+
+	// dangling holds the missing referenced ids grouped by their ref kind
+	// (for the hotspot settings kind the ids are of the Hotspot rows).
+	dangling map[string]map[int]struct{}
+}
+
+// isDangling reports whether the provided referenced id is dangling for the specified ref kind.
+func (c *integrityCheck) isDangling(kind string, id int) bool {
+	if c == nil {
+		return false
+	}
+
+	_, ok := c.dangling[kind][id]
+
+	return ok
+}
+
+// shouldDrop reports whether the v2 row with the provided referenced id should be dropped.
+func (c *integrityCheck) shouldDrop(kind string, id int) bool {
+	return c.isDangling(kind, id) && c.policies[kind] == danglingDrop
+}
+
+// resolveRef returns the v3 record id of the v2 row referenced with the specified ref kind.
+//
+// The returned id is empty if the reference is dangling or if the referenced
+// row wasn't migrated (eg. quarantined or skipped as invalid) and in that case
+// skip reports whether the referencing row should be dropped according to the ref policy.
+//
+// Returns an error if the referenced row wasn't migrated and the ref policy is "fail".
+func (m *Migrator) resolveRef(kind string, table string, v2Id int) (string, bool, error) {
+	if m.integrity.isDangling(kind, v2Id) {
+		return "", m.integrity.shouldDrop(kind, v2Id), nil
+	}
+
+	return m.lookupRef(kind, table, v2Id)
+}
+
+// lookupRef is similar to [Migrator.resolveRef] but without the dangling check
+// (eg. for the hotspot settings whose dangling ids are of the Hotspot rows).
+func (m *Migrator) lookupRef(kind string, table string, v2Id int) (string, bool, error) {
+	var id string
+	var ok bool
+	if table == "User" {
+		id, ok = m.userRecordId(v2Id)
+	} else {
+		id, ok = m.findRecordId(table, v2Id)
+	}
+	if ok {
+		return id, false, nil
+	}
+
+	policy := danglingNull
+	for _, ref := range danglingRefs {
+		if ref.Kind == kind {
+			policy = m.danglingPolicy(ref)
+			break
+		}
+	}
+
+	if policy == danglingFail {
+		return "", false, fmt.Errorf("the referenced v2 %s row %d (%s) is not migrated", table, v2Id, kind)
+	}
+
+	m.logger.Warn("Unresolved v2 reference to a not migrated row", "kind", kind, "refTable", table, "refId", v2Id, "policy", policy)
+
+	return "", policy == danglingDrop, nil
+}
+
+// CheckIntegrity searches for dangling v2 references and reports them.
+//
+// A reference to a row that is dropped because of its own dangling reference
+// is also considered dangling so that the "drop" policy cascades to the dependents.
+//
+// Returns an error if a dangling reference is found for a ref kind with "fail" policy.
+func (m *Migrator) CheckIntegrity() error {
+	check := &integrityCheck{
+		policies: make(map[string]string, len(danglingRefs)),
+		dangling: make(map[string]map[int]struct{}, len(danglingRefs)),
+	}
+
+	// the ids of the dropped rows grouped by their table
+	dropped := map[string]map[int]struct{}{}
+
+	// the number of dangling ids caused by a dropped row grouped by ref kind
+	cascaded := map[string]int{}
+
+	for _, ref := range danglingRefs {
+		check.policies[ref.Kind] = m.danglingPolicy(ref)
+
+		var ids map[int]struct{}
+		var err error
+		if ref.Kind == refHotspotSettingScreen {
+			ids, err = m.findDanglingHotspotSettings(dropped["Screen"])
+		} else {
+			ids, err = m.findDanglingIds(ref)
+			if err == nil {
+				cascaded[ref.Kind], err = m.addDroppedRefIds(ref, ids, dropped)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %s.%s references: %w", ref.Table, ref.Column, err)
+		}
+
+		check.dangling[ref.Kind] = ids
+
+		if len(ids) == 0 || check.policies[ref.Kind] != danglingDrop || ref.Kind == refHotspotSettingScreen {
+			continue
+		}
+
+		rowIds, err := m.findIdsByColumn("id", ref.Table, ref.Column, ids)
+		if err != nil {
+			return fmt.Errorf("failed to find the dropped %s rows: %w", ref.Table, err)
+		}
+		if dropped[ref.Table] == nil {
+			dropped[ref.Table] = map[int]struct{}{}
+		}
+		for _, id := range rowIds {
+			dropped[ref.Table][id] = struct{}{}
+		}
+	}
+
+	m.integrity = check
+
+	var failed []string
+
+	for _, ref := range danglingRefs {
+		ids := check.dangling[ref.Kind]
+		if len(ids) == 0 {
+			continue
+		}
+
+		policy := check.policies[ref.Kind]
+
+		m.logger.Warn(
+			"Found dangling v2 references",
+			"kind", ref.Kind,
+			"table", ref.Table,
+			"column", ref.Column,
+			"refTable", ref.RefTable,
+			"policy", policy,
+			"total", len(ids),
+			"droppedRefs", cascaded[ref.Kind],
+			"v2Ids", joinIds(ids, 10),
+		)
+
+		if policy == danglingFail {
+			failed = append(failed, ref.Kind)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("dangling v2 references found for %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// findDanglingIds returns the referenced ids of the provided ref
+// that doesn't exist in the referenced table.
+func (m *Migrator) findDanglingIds(ref danglingRef) (map[int]struct{}, error) {
+	var ids []int
+
+	err := m.oldDB.NewQuery(fmt.Sprintf(
+		"SELECT DISTINCT t.[[%[2]s]] FROM {{%[1]s}} t LEFT JOIN {{%[3]s}} r ON r.id = t.[[%[2]s]] WHERE t.[[%[2]s]] IS NOT NULL AND r.id IS NULL",
+		ref.Table, ref.Column, ref.RefTable,
+	)).Column(&ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		result[id] = struct{}{}
+	}
+
+	return result, nil
+}
+
+// addDroppedRefIds adds to ids the referenced ids of the provided ref
+// that point to an already dropped row and returns their number.
+//
+// The self references with "drop" policy (eg. ScreenComment.replyTo)
+// are resolved recursively (the replies of a dropped reply are dropped too).
+func (m *Migrator) addDroppedRefIds(ref danglingRef, ids map[int]struct{}, dropped map[string]map[int]struct{}) (int, error) {
+	selfDrop := ref.Table == ref.RefTable && m.danglingPolicy(ref) == danglingDrop
+
+	pending := maps.Clone(dropped[ref.RefTable])
+
+	if selfDrop && len(ids) > 0 {
+		rowIds, err := m.findIdsByColumn("id", ref.Table, ref.Column, ids)
+		if err != nil {
+			return 0, err
+		}
+		if pending == nil {
+			pending = map[int]struct{}{}
+		}
+		for _, id := range rowIds {
+			pending[id] = struct{}{}
+		}
+	}
+
+	var total int
+
+	for len(pending) > 0 {
+		refIds, err := m.findIdsByColumn(ref.Column, ref.Table, ref.Column, pending)
+		if err != nil {
+			return 0, err
+		}
+
+		added := map[int]struct{}{}
+		for _, id := range refIds {
+			if _, ok := ids[id]; !ok {
+				ids[id] = struct{}{}
+				added[id] = struct{}{}
+			}
+		}
+		total += len(added)
+
+		if !selfDrop || len(added) == 0 {
+			break
+		}
+
+		// the rows that reference the newly dropped rows are dropped too
+		rowIds, err := m.findIdsByColumn("id", ref.Table, ref.Column, added)
+		if err != nil {
+			return 0, err
+		}
+
+		pending = make(map[int]struct{}, len(rowIds))
+		for _, id := range rowIds {
+			pending[id] = struct{}{}
+		}
+	}
+
+	return total, nil
+}
+
+// danglingPolicy returns the configured dangling policy of the provided ref.
+func (m *Migrator) danglingPolicy(ref danglingRef) string {
+	if policy, ok := m.config.DanglingRefs[ref.Kind]; ok {
+		return policy
+	}
+
+	return ref.DefaultPolicy
+}
+
+// findIdsByColumn returns the distinct selectColumn values of the table rows
+// whose column value is one of the provided ids.
+func (m *Migrator) findIdsByColumn(selectColumn string, table string, column string, ids map[int]struct{}) ([]int, error) {
+	all := make([]any, 0, len(ids))
+	for id := range ids {
+		all = append(all, id)
+	}
+
+	var result []int
+
+	for chunk := range slices.Chunk(all, 500) {
+		var chunkResult []int
+
+		err := m.oldDB.Select(selectColumn).
+			Distinct(true).
+			From(table).
+			Where(dbx.In(column, chunk...)).
+			Column(&chunkResult)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, chunkResult...)
+	}
+
+	return result, nil
+}
+
+// findDanglingHotspotSettings returns the ids of the hotspots whose settings.screenId
+// points to a missing or dropped screen or to a screen from another prototype.
+func (m *Migrator) findDanglingHotspotSettings(droppedScreens map[int]struct{}) (map[int]struct{}, error) {
+	screens := []struct {
+		Id          int `db:"id"`
+		PrototypeId int `db:"prototypeId"`
+	}{}
+	if err := m.oldDB.Select("id", "prototypeId").From("Screen").All(&screens); err != nil {
+		return nil, err
+	}
+
+	screenPrototypes := make(map[int]int, len(screens))
+	for _, s := range screens {
+		screenPrototypes[s.Id] = s.PrototypeId
+	}
+
+	hotspots := []struct {
+		Id          int     `db:"id"`
+		Settings    *string `db:"settings"`
+		PrototypeId *int    `db:"prototypeId"`
+	}{}
+	err := m.oldDB.NewQuery(`
+		SELECT h.id, h.settings, COALESCE([[s.prototypeId]], [[t.prototypeId]]) AS [[prototypeId]]
+		FROM {{Hotspot}} h
+		LEFT JOIN {{Screen}} s ON s.id = [[h.screenId]]
+		LEFT JOIN {{HotspotTemplate}} t ON t.id = [[h.hotspotTemplateId]]
+		WHERE h.settings IS NOT NULL
+	`).All(&hotspots)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int]struct{}{}
+
+	for _, h := range hotspots {
+		if h.Settings == nil || *h.Settings == "" {
+			continue
+		}
+
+		settings := map[string]any{}
+		if err := json.Unmarshal([]byte(*h.Settings), &settings); err != nil {
+			continue // invalid settings are reported during the hotspots migration
+		}
+
+		screenId := cast.ToString(settings["screenId"])
+		if screenId == "" {
+			continue
+		}
+
+		_, isDropped := droppedScreens[cast.ToInt(screenId)]
+
+		prototypeId, ok := screenPrototypes[cast.ToInt(screenId)]
+		if !ok || isDropped || (h.PrototypeId != nil && *h.PrototypeId != prototypeId) {
+			result[h.Id] = struct{}{}
+		}
+	}
+
+	return result, nil
+}
+
+// joinIds returns a sorted comma separated string with up to max ids.
+func joinIds(ids map[int]struct{}, max int) string {
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	parts := make([]string, 0, max+1)
+	for i, id := range sorted {
+		if i == max {
+			parts = append(parts, "...")
+			break
+		}
+		parts = append(parts, cast.ToString(id))
+	}
+
+	return strings.Join(parts, ", ")
+}
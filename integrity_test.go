@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+// newTestV2DB creates a temp SQLite v2 DB with the foreign key columns
+// of the v2 tables and the same rows as the testdata/v2dump.sql fixture.
+func newTestV2DB(t *testing.T) *dbx.DB {
+	t.Helper()
+
+	db, err := dbx.Open("sqlite", filepath.Join(t.TempDir(), "v2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tables := map[string][]string{
+		"User":                     nil,
+		"UserAuth":                 {"userId"},
+		"Project":                  nil,
+		"UserProjectRel":           {"userId", "projectId"},
+		"Prototype":                {"projectId"},
+		"Screen":                   {"prototypeId"},
+		"ScreenComment":            {"replyTo", "screenId"},
+		"HotspotTemplate":          {"prototypeId"},
+		"HotspotTemplateScreenRel": {"hotspotTemplateId", "screenId"},
+		"Hotspot":                  {"screenId", "hotspotTemplateId", "settings"},
+		"ProjectLink":              {"projectId"},
+		"ProjectLinkPrototypeRel":  {"projectLinkId", "prototypeId"},
+		"UserScreenCommentRel":     {"userId", "screenCommentId"},
+	}
+	for table, columns := range tables {
+		cols := db.QuoteColumnName("id") + " INTEGER PRIMARY KEY"
+		for _, c := range columns {
+			cols += ", " + db.QuoteColumnName(c)
+		}
+		if _, err := db.NewQuery("CREATE TABLE " + db.QuoteTableName(table) + " (" + cols + ")").Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := []struct {
+		table  string
+		params dbx.Params
+	}{
+		{"User", dbx.Params{"id": 1}},
+		{"User", dbx.Params{"id": 2}},
+		{"Project", dbx.Params{"id": 1}},
+		{"UserProjectRel", dbx.Params{"id": 1, "userId": 1, "projectId": 1}},
+		{"UserProjectRel", dbx.Params{"id": 2, "userId": 2, "projectId": 1}},
+		{"Prototype", dbx.Params{"id": 1, "projectId": 1}},
+		{"Screen", dbx.Params{"id": 1, "prototypeId": 1}},
+		{"Screen", dbx.Params{"id": 2, "prototypeId": 1}},
+		{"ScreenComment", dbx.Params{"id": 1, "screenId": 1}},
+		{"ScreenComment", dbx.Params{"id": 2, "screenId": 1, "replyTo": 1}},
+		{"HotspotTemplate", dbx.Params{"id": 1, "prototypeId": 1}},
+		{"HotspotTemplateScreenRel", dbx.Params{"id": 1, "hotspotTemplateId": 1, "screenId": 1}},
+		{"HotspotTemplateScreenRel", dbx.Params{"id": 2, "hotspotTemplateId": 1, "screenId": 2}},
+		{"Hotspot", dbx.Params{"id": 1, "screenId": 1, "settings": `{"screenId":2,"transition":"none"}`}},
+		{"Hotspot", dbx.Params{"id": 2, "hotspotTemplateId": 1, "settings": "{}"}},
+		{"ProjectLink", dbx.Params{"id": 1, "projectId": 1}},
+		{"ProjectLinkPrototypeRel", dbx.Params{"id": 1, "projectLinkId": 1, "prototypeId": 1}},
+		{"UserScreenCommentRel", dbx.Params{"id": 1, "userId": 2, "screenCommentId": 1}},
+	}
+	for _, row := range rows {
+		if _, err := db.Insert(row.table, row.params).Execute(); err != nil {
+			t.Fatalf("failed to insert %s row: %v", row.table, err)
+		}
+	}
+
+	return db
+}
+
+// insertTestOrphanChain inserts v2 rows that depend on the missing project 99
+// (either directly or through other dropped rows).
+func insertTestOrphanChain(t *testing.T, db *dbx.DB) {
+	t.Helper()
+
+	// orphan chain: missing project 99 <- prototype 5 <- screen 7 <- comments, hotspots, ...
+	rows := []struct {
+		table  string
+		params dbx.Params
+	}{
+		{"Prototype", dbx.Params{"id": 5, "projectId": 99}},
+		{"Screen", dbx.Params{"id": 7, "prototypeId": 5}},
+		{"ScreenComment", dbx.Params{"id": 10, "screenId": 7}},
+		{"ScreenComment", dbx.Params{"id": 11, "screenId": 7, "replyTo": 10}},
+		{"ScreenComment", dbx.Params{"id": 12, "screenId": 1, "replyTo": 11}},
+		{"HotspotTemplate", dbx.Params{"id": 5, "prototypeId": 5}},
+		{"HotspotTemplateScreenRel", dbx.Params{"id": 5, "hotspotTemplateId": 1, "screenId": 7}},
+		{"Hotspot", dbx.Params{"id": 10, "screenId": 7, "settings": "{}"}},
+		{"Hotspot", dbx.Params{"id": 11, "hotspotTemplateId": 5, "settings": "{}"}},
+		{"Hotspot", dbx.Params{"id": 12, "screenId": 1, "settings": `{"screenId":7}`}},
+		{"ProjectLinkPrototypeRel", dbx.Params{"id": 5, "projectLinkId": 1, "prototypeId": 5}},
+		{"UserScreenCommentRel", dbx.Params{"id": 5, "userId": 1, "screenCommentId": 11}},
+	}
+	for _, row := range rows {
+		if _, err := db.Insert(row.table, row.params).Execute(); err != nil {
+			t.Fatalf("failed to insert %s row: %v", row.table, err)
+		}
+	}
+}
+
+func TestCheckIntegrityCascade(t *testing.T) {
+	m := &Migrator{oldDB: newTestV2DB(t), config: &Config{}, logger: slog.Default()}
+
+	insertTestOrphanChain(t, m.oldDB)
+
+	if err := m.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		kind       string
+		id         int
+		dangling   bool
+		shouldDrop bool
+	}{
+		{refPrototypeProject, 99, true, true},
+		{refScreenPrototype, 5, true, true},
+		{refScreenPrototype, 1, false, false},
+		{refCommentScreen, 7, true, true},
+		{refCommentReplyTo, 10, true, false},
+		{refCommentReplyTo, 11, true, false},
+		{refTemplatePrototype, 5, true, true},
+		{refTemplateScreen, 7, true, true},
+		{refHotspotScreen, 7, true, true},
+		{refHotspotTemplate, 5, true, true},
+		{refHotspotTemplate, 1, false, false},
+		{refHotspotSettingScreen, 12, true, false},
+		{refHotspotSettingScreen, 1, false, false},
+		{refLinkPrototype, 5, true, true},
+		{refNotificationComment, 11, true, true},
+		{refNotificationComment, 1, false, false},
+	}
+
+	for _, s := range scenarios {
+		if dangling := m.integrity.isDangling(s.kind, s.id); dangling != s.dangling {
+			t.Errorf("[%s %d] expected dangling %v, got %v", s.kind, s.id, s.dangling, dangling)
+		}
+		if shouldDrop := m.integrity.shouldDrop(s.kind, s.id); shouldDrop != s.shouldDrop {
+			t.Errorf("[%s %d] expected shouldDrop %v, got %v", s.kind, s.id, s.shouldDrop, shouldDrop)
+		}
+	}
+}
+
+func TestCheckIntegritySelfReferenceDrop(t *testing.T) {
+	config := &Config{DanglingRefs: map[string]string{refCommentReplyTo: danglingDrop}}
+
+	m := &Migrator{oldDB: newTestV2DB(t), config: config, logger: slog.Default()}
+
+	// reply chain to a missing comment: 99 <- 10 <- 11 <- 12
+	for _, c := range []dbx.Params{
+		{"id": 10, "screenId": 1, "replyTo": 99},
+		{"id": 11, "screenId": 1, "replyTo": 10},
+		{"id": 12, "screenId": 1, "replyTo": 11},
+	} {
+		if _, err := m.oldDB.Insert("ScreenComment", c).Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int{99, 10, 11} {
+		if !m.integrity.shouldDrop(refCommentReplyTo, id) {
+			t.Errorf("expected replies to %d to be dropped", id)
+		}
+	}
+
+	// the original reply (id 1) is still valid
+	if m.integrity.isDangling(refCommentReplyTo, 1) {
+		t.Error("expected replyTo 1 to be valid")
+	}
+}
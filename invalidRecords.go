@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	invalidRecordsForce = "force"
+	invalidRecordsSkip  = "skip"
+	invalidRecordsFix   = "fix"
+)
+
+// fixedTextPlaceholder is the value used to fix required text fields.
+const fixedTextPlaceholder = "Untitled"
+
+// quarantineEntry describes a single migrated record that didn't pass the v3 validations.
+type quarantineEntry struct {
+	Collection string
+	RecordId   string
+	Action     string
+	Error      string
+}
+
+// quarantine collects the migrated records that didn't pass the v3 validations.
+type quarantine struct {
+	mu      sync.Mutex
+	entries []*quarantineEntry
+}
+
+// add registers a new quarantine entry.
+func (q *quarantine) add(record *core.Record, action string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.entries = append(q.entries, &quarantineEntry{
+		Collection: record.Collection().Name,
+		RecordId:   record.Id,
+		Action:     action,
+		Error:      err.Error(),
+	})
+}
+
+// report logs a summary with all quarantine entries.
+func (q *quarantine) report(logger *slog.Logger) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return
+	}
+
+	logger.Warn("Quarantine report", "total", len(q.entries))
+
+	totals := map[string]int{}
+	for _, e := range q.entries {
+		logger.Warn("Invalid record", "step", e.Collection, "v3Id", e.RecordId, "action", e.Action, "error", e.Error)
+		totals[e.Action]++
+	}
+
+	actions := make([]string, 0, len(totals))
+	for action := range totals {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		logger.Warn("Quarantine total", "action", action, "total", totals[action])
+	}
+}
+
+// saveRecord validates and saves the provided migrated record
+// according to the configured Config.InvalidRecords policy.
+//
+// skipFields could be used to exclude fields from the validation
+// (eg. relations to records that are not migrated yet).
+//
+// Returns false if the record was invalid and skipped.
+func (m *Migrator) saveRecord(record *core.Record, skipFields ...string) (bool, error) {
+	errs, err := m.validateRecord(record, skipFields...)
+	if err != nil {
+		return false, err
+	}
+
+	if len(errs) > 0 {
+		switch m.config.InvalidRecords {
+		case invalidRecordsSkip:
+			m.quarantine.add(record, "skipped", errs)
+			return false, nil
+		case invalidRecordsFix:
+			m.fixRecordFields(record, errs)
+
+			fixErrs, err := m.validateRecord(record, skipFields...)
+			if err != nil {
+				return false, err
+			}
+			if len(fixErrs) > 0 {
+				m.quarantine.add(record, "skipped", fixErrs)
+				return false, nil
+			}
+
+			m.quarantine.add(record, "fixed", errs)
+		default:
+			m.quarantine.add(record, "forced", errs)
+		}
+	}
+
+	return true, m.pbApp.SaveNoValidate(record)
+}
+
+// validateRecord runs the v3 validations for the provided record and
+// returns its field errors.
+//
+// The "id" field is always excluded because the prefixed migration ids
+// doesn't match the default id pattern.
+func (m *Migrator) validateRecord(record *core.Record, skipFields ...string) (validation.Errors, error) {
+	err := m.pbApp.Validate(record)
+	if err == nil {
+		return nil, nil
+	}
+
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		return nil, fmt.Errorf("failed to validate %q: %w", record.Id, err)
+	}
+
+	result := validation.Errors{}
+	for name, fieldErr := range errs {
+		if name == core.FieldNameId || slices.Contains(skipFields, name) {
+			continue
+		}
+		// the migrated file fields hold plain file names (the files are copied separately)
+		if _, ok := record.Collection().Fields.GetByName(name).(*core.FileField); ok {
+			continue
+		}
+		result[name] = fieldErr
+	}
+
+	return result, nil
+}
+
+// fixRecordFields resets the invalid record fields to their defaults.
+func (m *Migrator) fixRecordFields(record *core.Record, errs validation.Errors) {
+	for name := range errs {
+		switch f := record.Collection().Fields.GetByName(name).(type) {
+		case *core.NumberField:
+			val := record.GetFloat(name)
+			if f.Min != nil && val < *f.Min {
+				val = *f.Min
+			}
+			if f.Max != nil && val > *f.Max {
+				val = *f.Max
+			}
+			if f.OnlyInt {
+				val = float64(int64(val))
+			}
+			record.Set(name, val)
+		case *core.TextField:
+			val := []rune(record.GetString(name))
+			if f.Max > 0 && len(val) > f.Max {
+				record.Set(name, string(val[:f.Max]))
+			} else if f.Required {
+				record.Set(name, fixedTextPlaceholder)
+			} else {
+				record.Set(name, "")
+			}
+		case nil:
+			// not a collection field
+		default:
+			record.Set(name, nil)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSaveRecordFileFields(t *testing.T) {
+	policies := []string{invalidRecordsForce, invalidRecordsSkip, invalidRecordsFix}
+
+	for _, policy := range policies {
+		t.Run(policy, func(t *testing.T) {
+			app := newTestApp(t)
+
+			m := &Migrator{
+				pbApp:      app,
+				config:     &Config{InvalidRecords: policy},
+				quarantine: &quarantine{},
+			}
+
+			scenarios := []struct {
+				collection string
+				field      string
+				value      string
+			}{
+				{"users", "avatar", "avatar.png"},
+				{"screens", "file", "screen1.png"},
+			}
+
+			for _, s := range scenarios {
+				collection, err := app.FindCollectionByNameOrId(s.collection)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// the migrated file fields hold only the name of the separately copied file
+				record := core.NewRecord(collection)
+				record.Id = "pr2_1"
+				if collection.IsAuth() {
+					record.SetEmail("test@example.com")
+					record.SetPassword("1234567890")
+				}
+				record.Set(s.field, s.value)
+
+				saved, err := m.saveRecord(record)
+				if err != nil {
+					t.Fatalf("[%s] failed to save: %v", s.collection, err)
+				}
+				if !saved {
+					t.Fatalf("[%s] expected the record to be saved", s.collection)
+				}
+
+				record, err = app.FindRecordById(s.collection, "pr2_1")
+				if err != nil {
+					t.Fatalf("[%s] missing record: %v", s.collection, err)
+				}
+				if v := record.GetString(s.field); v != s.value {
+					t.Errorf("[%s] expected %s %q, got %q", s.collection, s.field, s.value, v)
+				}
+			}
+
+			for _, e := range m.quarantine.entries {
+				t.Errorf("unexpected quarantine entry %s %s (%s): %s", e.Collection, e.RecordId, e.Action, e.Error)
+			}
+		})
+	}
+}
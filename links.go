@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
@@ -13,6 +15,9 @@ func (m *Migrator) MigrateLinks() error {
 		return err
 	}
 
+	progress := m.startProgress("links", "ProjectLink")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -22,16 +27,31 @@ func (m *Migrator) MigrateLinks() error {
 		q := m.oldDB.Select("*").
 			From("ProjectLink").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("ProjectLink")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel, "link"))
+			progress.add(1)
+
+			projectId, skip, err := m.resolveRef(refLinkProject, "Project", item.ProjectId)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue // dangling reference
+			}
+
+			insertedIds = append(insertedIds, m.buildRecordId("ProjectLink", item.baseModel))
 
-			record := m.initRecordToMigrate(collection, item.baseModel, "link")
+			record := m.initRecordToMigrate(collection, "ProjectLink", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -42,13 +62,24 @@ func (m *Migrator) MigrateLinks() error {
 			updatedAt, _ := types.ParseDateTime(item.UpdatedAt)
 			record.SetRaw("updated", updatedAt)
 
-			record.Set("project", fmt.Sprintf("%s%d", v2Prefix, item.ProjectId))
-			record.Set("username", item.Slug)
+			record.Set("project", projectId)
+
+			// the same slug could be already used by a link from another v2 installation
+			username := item.Slug
+			if m.isTakenLinkSlug(collection, record.Id, username) {
+				if current := record.GetString("username"); !record.IsNew() && current != item.Slug && strings.HasPrefix(current, item.Slug) {
+					username = current // keep the previously generated one
+				} else {
+					username = suggestUniqueAuthRecordUsername(m.pbApp, collection.Id, item.Slug)
+				}
+				m.logger.Warn("Renamed duplicated link slug", "step", "links", "v2Id", item.Id, "slug", item.Slug, "newSlug", username)
+			}
+			record.Set("username", username)
 			record.Set("allowComments", item.AllowComments)
 
 			record.RefreshTokenKey()
 			if item.PasswordHash != nil && *item.PasswordHash != "" {
-				record.SetRaw("password", *item.PasswordHash)
+				record.SetRaw("password", &core.PasswordFieldValue{Hash: *item.PasswordHash})
 				record.Set("passwordProtect", true)
 			} else {
 				// the value doesn't matter in this case
@@ -58,12 +89,17 @@ func (m *Migrator) MigrateLinks() error {
 
 			prototypeIds, err := m.getPrefixedLinkPrototypeIds(item.Id)
 			if err != nil {
-				return fmt.Errorf("failed to retrieve link %d prototypes: %w", item.Id, err)
+				if err := m.quarantineRow("links", "ProjectLink", item.Id, item, fmt.Errorf("failed to retrieve link %d prototypes: %w", item.Id, err)); err != nil {
+					return err
+				}
+				continue
 			}
 			record.Set("onlyPrototypes", prototypeIds)
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("links", "ProjectLink", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -84,19 +120,42 @@ func (m *Migrator) MigrateLinks() error {
 func (m *Migrator) getPrefixedLinkPrototypeIds(linkId int) ([]string, error) {
 	var ids []int
 
-	err := m.oldDB.Select("prototypeId").
-		From("ProjectLinkPrototypeRel").
-		AndWhere(dbx.HashExp{"projectLinkId": linkId}).
-		Column(&ids)
+	err := m.retry("v2 relation query", func() error {
+		ids = nil
+		return m.oldDB.Select("prototypeId").
+			From("ProjectLinkPrototypeRel").
+			AndWhere(dbx.HashExp{"projectLinkId": linkId}).
+			Column(&ids)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]string, len(ids))
+	result := make([]string, 0, len(ids))
 
-	for i, id := range ids {
-		result[i] = fmt.Sprintf("%s%d", v2Prefix, id)
+	for _, id := range ids {
+		// for the relation rows both drop and null remove only the dangling id
+		prototypeId, _, err := m.resolveRef(refLinkPrototype, "Prototype", id)
+		if err != nil {
+			return nil, err
+		}
+		if prototypeId != "" {
+			result = append(result, prototypeId)
+		}
 	}
 
 	return result, nil
 }
+
+// isTakenLinkSlug checks whether the slug is already used by another links record.
+func (m *Migrator) isTakenLinkSlug(collection *core.Collection, recordId string, slug string) bool {
+	total, err := m.pbApp.CountRecords(
+		collection,
+		dbx.NewExp("LOWER([[username]])={:username} AND [[id]]!={:id}", dbx.Params{
+			"username": strings.ToLower(slug),
+			"id":       recordId,
+		}),
+	)
+
+	return err == nil && total > 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+)
+
+// stdout is the shared terminal used for the logs and the live progress bar.
+var stdout = &terminal{
+	out: os.Stdout,
+	tty: isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()),
+}
+
+// terminal serializes the writes to the underlying output so that
+// the log lines don't get mixed with the live progress bar.
+type terminal struct {
+	mu         sync.Mutex
+	out        io.Writer
+	tty        bool
+	barVisible bool
+}
+
+// Write implements [io.Writer] and clears the progress bar line (if any) before writing p.
+func (t *terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clearBar()
+
+	return t.out.Write(p)
+}
+
+// writeBar replaces the current progress bar line with the provided one.
+func (t *terminal) writeBar(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clearBar()
+
+	fmt.Fprint(t.out, line)
+
+	t.barVisible = true
+}
+
+// endBar moves the cursor after the current progress bar line (if any)
+// so that it is not cleared by the next write.
+func (t *terminal) endBar() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.barVisible {
+		fmt.Fprintln(t.out)
+		t.barVisible = false
+	}
+}
+
+func (t *terminal) clearBar() {
+	if t.barVisible {
+		fmt.Fprint(t.out, "\r\033[K")
+		t.barVisible = false
+	}
+}
+
+// newLogger creates a new structured logger that writes to stdout
+// and optionally appends to the provided log file.
+//
+// format could be "text" (default) or "json".
+// level could be "debug", "info" (default), "warn" or "error".
+//
+// Note that the log file is intentionally left open for the rest
+// of the process lifetime so that the final errors are logged too.
+func newLogger(format string, level string, logFile string) (*slog.Logger, error) {
+	var w io.Writer = stdout
+
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w = io.MultiWriter(stdout, f)
+	}
+
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: slogLevel}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (must be text or json)", format)
+	}
+}
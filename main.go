@@ -1,33 +1,114 @@
 package main
 
 import (
+	"cmp"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 
-	"github.com/fatih/color"
 	"github.com/pocketbase/pocketbase"
 )
 
 func main() {
 	if err := run(); err != nil {
-		color.Red(err.Error())
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	// Resolve the command (defaults to "migrate")
+	// ---------------------------------------------------------------
+	command := "migrate"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	commands := []string{"migrate", "cutover", "export", "import", "redirects", "redirect-serve", "retry-quarantine"}
+	if !slices.Contains(commands, command) {
+		return fmt.Errorf("unknown command %q (available commands: %s)", command, strings.Join(commands, ", "))
+	}
+
 	// Load config from user specified config.json file
 	// ---------------------------------------------------------------
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+
 	var configPath string
-	flag.StringVar(&configPath, "config", "./config.json", "Path to the migration config json file")
-	flag.Parse()
+	fs.StringVar(&configPath, "config", "./config.json", "Path to the migration config json file (comments are allowed)")
+
+	registerConfigFlags(fs)
+
+	var maxRuns int
+	fs.IntVar(&maxRuns, "max-runs", 10, "Max number of cutover runs before giving up (cutover only)")
+
+	var outDir string
+	fs.StringVar(&outDir, "out", "", "The output directory (export and redirects only; default to ./v2bundle and ./redirects)")
+
+	var addr string
+	fs.StringVar(&addr, "addr", ":8080", "The redirect server listen address (redirect-serve only)")
 
-	config, err := NewConfigFromJson(configPath)
+	var logFormat string
+	fs.StringVar(&logFormat, "log-format", "text", "Log output format - text or json")
+
+	var logLevel string
+	fs.StringVar(&logLevel, "log-level", "info", "Min log level - debug, info, warn or error")
+
+	var logFile string
+	fs.StringVar(&logFile, "log-file", "", "Optional file path where to append the logs")
+
+	fs.Parse(args)
+
+	// Init logger
+	// ---------------------------------------------------------------
+	logger, err := newLogger(logFormat, logLevel, logFile)
 	if err != nil {
 		return err
 	}
-	if err := config.Validate(); err != nil {
+	slog.SetDefault(logger)
+
+	// the config file is optional if not explicitly set
+	// (the settings could be also loaded from env variables and flags)
+	config := &Config{}
+	if _, statErr := os.Stat(configPath); statErr == nil || isFlagSet(fs, "config") {
+		config, err = NewConfigFromJson(configPath)
+		if err != nil {
+			return err
+		}
+	}
+	if err := config.ApplyOverrides(fs); err != nil {
+		return fmt.Errorf("[config error] %w", err)
+	}
+
+	if command == "export" {
+		if err := config.ValidateSource(); err != nil {
+			return fmt.Errorf("[config error] %w", err)
+		}
+
+		exporter, err := NewExporter(config)
+		if err != nil {
+			return fmt.Errorf("failed to initialize exporter: %w", err)
+		}
+		defer exporter.Close()
+
+		return exporter.Export(cmp.Or(outDir, "./v2bundle"))
+	}
+
+	if command == "import" && config.V2BundleDir == "" {
+		return errors.New("[config error] the import command requires v2BundleDir (or the -v2-bundle-dir flag)")
+	}
+
+	// the redirect server works only with pb_data
+	// (it is expected to run after the cutover when the v2 source could be already gone)
+	validate := config.Validate
+	if command == "redirect-serve" {
+		validate = config.ValidateTarget
+	}
+	if err := validate(); err != nil {
 		return fmt.Errorf("[config error] %w", err)
 	}
 
@@ -42,6 +123,15 @@ func run() error {
 		return err
 	}
 
+	if command == "redirect-serve" {
+		server, err := NewRedirectServer(app, config)
+		if err != nil {
+			return fmt.Errorf("failed to initialize redirect server: %w", err)
+		}
+
+		return server.Serve(addr)
+	}
+
 	// Migrate
 	// ---------------------------------------------------------------
 	migrator, err := NewMigrator(app, config)
@@ -50,5 +140,27 @@ func run() error {
 	}
 	defer migrator.Close()
 
+	switch command {
+	case "cutover":
+		return migrator.Cutover(maxRuns)
+	case "redirects":
+		return migrator.GenerateRedirects(cmp.Or(outDir, "./redirects"))
+	case "retry-quarantine":
+		return migrator.RetryQuarantine()
+	}
+
 	return migrator.MigrateAll()
 }
+
+// isFlagSet reports whether the named flag was explicitly set.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	var found bool
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
+}
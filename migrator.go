@@ -5,9 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/filesystem"
@@ -18,6 +21,7 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// v2Prefix is the default v3 record id prefix of the migrated v2 records.
 const v2Prefix string = "pr2_"
 
 // NewMigrator creates and setup a new Migrator instance.
@@ -37,36 +41,23 @@ const v2Prefix string = "pr2_"
 //	}
 func NewMigrator(app core.App, config *Config) (*Migrator, error) {
 	m := &Migrator{
-		pbApp: app,
+		pbApp:       app,
+		config:      config,
+		quarantine:  &quarantine{},
+		failedFiles: &failedFiles{},
+		fileStats:   &fileCopyStats{},
+		imageStats:  &imageStats{},
+		mergedUsers: map[int]string{},
 	}
+	m.logger = slog.New(&issuesHandler{next: slog.Default().Handler(), m: m})
 
-	var errOldDB error
-	m.oldDB, errOldDB = dbx.MustOpen(config.V2DBDriver, config.V2DBConnection)
-	if errOldDB != nil {
+	if err := m.openSource(); err != nil {
 		m.Close()
-		return nil, errOldDB
-	}
-
-	var errOldFS error
-	if config.V2S3Storage.Bucket != "" {
-		m.oldFS, errOldFS = filesystem.NewS3(
-			config.V2S3Storage.Bucket,
-			config.V2S3Storage.Region,
-			config.V2S3Storage.Endpoint,
-			config.V2S3Storage.AccessKey,
-			config.V2S3Storage.Secret,
-			config.V2S3Storage.ForcePathStyle,
-		)
-	} else {
-		m.oldFS, errOldFS = filesystem.NewLocal(config.V2LocalStorage)
-	}
-	if errOldFS != nil {
-		m.Close()
-		return nil, errOldFS
+		return nil, err
 	}
 
 	var errNewFS error
-	m.newFS, errNewFS = app.NewFilesystem()
+	m.newFS, errNewFS = newV3Filesystem(app, config)
 	if errNewFS != nil {
 		m.Close()
 		return nil, errNewFS
@@ -75,11 +66,64 @@ func NewMigrator(app core.App, config *Config) (*Migrator, error) {
 	return m, nil
 }
 
+// openSource opens the configured v2 DB (or its local store) and v2 files storage.
+//
+// A v1 source DB is converted to a local store with the v2 schema (see [Migrator.loadV1Source]).
+func (m *Migrator) openSource() error {
+	var err error
+
+	switch {
+	case m.config.V2BundleDir != "":
+		m.logger.Info("Loading v2 bundle...", "dir", m.config.V2BundleDir)
+		m.oldDB, m.dumpStore, err = loadV2Bundle(m.config.V2BundleDir, m.logger)
+	case m.config.V2DumpFile != "":
+		m.logger.Info("Loading v2 dump file...", "file", m.config.V2DumpFile)
+		m.oldDB, m.dumpStore, err = loadV2Dump(m.config.V2DumpFile, m.config.V2DBDriver, m.logger)
+	default:
+		var dsn string
+		dsn, err = m.config.V2DSN()
+		if err != nil {
+			return err
+		}
+
+		m.oldDB, err = dbx.MustOpen(m.config.V2DBDriver, dsn)
+		if err == nil {
+			m.config.V2DBOptions.applyPool(m.oldDB.DB())
+		}
+
+		if err == nil && m.config.SourceVersion == sourceV1 {
+			m.logger.Info("Converting v1 data...")
+			err = m.loadV1Source()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	m.oldFS, err = newSourceFS(m.config)
+
+	return err
+}
+
 type Migrator struct {
-	oldDB *dbx.DB
-	pbApp core.App
-	oldFS *filesystem.System
-	newFS *filesystem.System
+	oldDB       *dbx.DB
+	dumpStore   string
+	pbApp       core.App
+	oldFS       sourceFS
+	newFS       *filesystem.System
+	config      *Config
+	quarantine  *quarantine
+	failedFiles *failedFiles
+	fileStats   *fileCopyStats
+	imageStats  *imageStats
+	mergedUsers map[int]string
+	idMap       *idMap
+	failedRows  int
+	retryRows   map[string][]int
+	integrity   *integrityCheck
+	progress    *progress
+	logger      *slog.Logger
+	run         atomic.Pointer[migrationRun]
 }
 
 // Close takes care to cleanup migrator related resources.
@@ -88,6 +132,10 @@ func (m *Migrator) Close() {
 		m.oldDB.Close()
 	}
 
+	if m.dumpStore != "" {
+		os.Remove(m.dumpStore)
+	}
+
 	if m.oldFS != nil {
 		m.oldFS.Close()
 	}
@@ -98,87 +146,141 @@ func (m *Migrator) Close() {
 }
 
 // MigrateAll executes all available model migrations.
-func (m *Migrator) MigrateAll() error {
+//
+// The run status, per step stats and all logged warnings are persisted
+// in the pb_data "_migrationRuns" and "_migrationIssues" collections.
+func (m *Migrator) MigrateAll() (err error) {
 	start := time.Now()
 
-	color.Green("Presentator v2 to v3 migration started...")
+	m.logger.Info("Presentator v2 to v3 migration started...")
 
-	color.Yellow("Migrating users...")
-	if err := m.MigrateUsers(); err != nil {
-		return fmt.Errorf("failed to migrate users: %w", err)
+	m.quarantine = &quarantine{}
+	m.failedFiles = &failedFiles{}
+	m.fileStats = &fileCopyStats{}
+	m.imageStats = &imageStats{}
+	m.mergedUsers = map[int]string{}
+	m.failedRows = 0
+
+	// no pb_data writes before the preflight
+	if err := m.Preflight(); err != nil {
+		return err
 	}
 
-	color.Yellow("Migrating OAuth2 rels...")
-	if err := m.MigrateUsersOAuth2(); err != nil {
-		return fmt.Errorf("failed to migrate OAuth2 rels: %w", err)
+	if err := m.startRun(); err != nil {
+		return err
 	}
+	defer func() {
+		m.finishRun(err)
+	}()
 
-	color.Yellow("Migrating projects...")
-	if err := m.MigrateProjects(); err != nil {
-		return fmt.Errorf("failed to migrate projects: %w", err)
+	if err := m.loadIdMap(); err != nil {
+		return err
 	}
 
-	color.Yellow("Migrating project user preferences...")
-	if err := m.MigrateProjectUserPreferences(); err != nil {
-		return fmt.Errorf("failed to migrate project user preferences: %w", err)
+	if err := m.ensureFileMapCollection(); err != nil {
+		return fmt.Errorf("failed to create the %s collection: %w", fileMapCollectionName, err)
 	}
 
-	color.Yellow("Migrating prototypes...")
-	if err := m.MigratePrototypes(); err != nil {
-		return fmt.Errorf("failed to migrate prototypes: %w", err)
+	// a full run processes all rows again so the previous quarantine is no longer relevant
+	if err := m.ensureQuarantineCollection(); err != nil {
+		return fmt.Errorf("failed to create the %s collection: %w", quarantineCollectionName, err)
+	}
+	if err := m.clearQuarantine(); err != nil {
+		return fmt.Errorf("failed to clear the previous quarantine: %w", err)
 	}
 
-	color.Yellow("Migrating screens...")
-	if err := m.MigrateScreens(); err != nil {
-		return fmt.Errorf("failed to migrate screens: %w", err)
+	m.logger.Info("Checking v2 references integrity...")
+	if err := m.CheckIntegrity(); err != nil {
+		return err
 	}
 
-	color.Yellow("Migrating screen comments...")
-	if err := m.MigrateScreenComments(); err != nil {
-		return fmt.Errorf("failed to migrate screen comments: %w", err)
+	for _, step := range m.migrationSteps() {
+		if err := m.runStep(step.name, step.title, step.fn); err != nil {
+			return err
+		}
+
+		if err := m.checkFileErrorRate(false); err != nil {
+			return err
+		}
 	}
 
-	color.Yellow("Migrating hotspot templates...")
-	if err := m.MigrateHotspotTemplates(); err != nil {
-		return fmt.Errorf("failed to migrate hotspot templates: %w", err)
+	if err := m.runStep("fileRetries", "failed files", m.RetryFailedFiles); err != nil {
+		return err
 	}
 
-	color.Yellow("Migrating hotspots...")
-	if err := m.MigrateHotspots(); err != nil {
-		return fmt.Errorf("failed to migrate hotspots: %w", err)
+	if m.config.GenerateThumbs {
+		if err := m.runStep("thumbs", "screen thumbs", m.GenerateScreenThumbs); err != nil {
+			return err
+		}
 	}
 
-	color.Yellow("Migrating project links...")
-	if err := m.MigrateLinks(); err != nil {
-		return fmt.Errorf("failed to migrate project links: %w", err)
+	if err := m.UpdateStorageSettings(); err != nil {
+		return fmt.Errorf("failed to update the pb_data storage settings: %w", err)
 	}
 
-	color.Yellow("Migrating unread notifications...")
-	if err := m.MigrateNotifications(); err != nil {
-		return fmt.Errorf("failed to migrate notifications: %w", err)
+	m.fileStats.report(m.logger)
+	if m.config.ValidateImages {
+		m.imageStats.report(m.logger)
 	}
+	m.quarantine.report(m.logger)
+	m.reportFailedRows()
 
-	color.Green("Migration completed successfully (%v).", time.Since(start))
+	m.logger.Info("Migration completed successfully.", "elapsed", time.Since(start).String())
 
 	return nil
 }
 
-// buildRecordId constructs a Record id from the provided base model and optional prefixes.
-func (m *Migrator) buildRecordId(item baseModel, optIdPrefixes ...string) string {
-	itemId := v2Prefix
-	for _, p := range optIdPrefixes {
-		itemId += p
+// migrationStep describes a single model migration step.
+type migrationStep struct {
+	name  string
+	title string
+	table string // the main v2 table
+	fn    func() error
+}
+
+// migrationSteps returns the model migration steps in their execution order.
+func (m *Migrator) migrationSteps() []migrationStep {
+	return []migrationStep{
+		{"users", "users", "User", m.MigrateUsers},
+		{"oauth2", "OAuth2 rels", "UserAuth", m.MigrateUsersOAuth2},
+		{"projects", "projects", "Project", m.MigrateProjects},
+		{"projectUserPreferences", "project user preferences", "UserProjectRel", m.MigrateProjectUserPreferences},
+		{"prototypes", "prototypes", "Prototype", m.MigratePrototypes},
+		{"screens", "screens", "Screen", m.MigrateScreens},
+		{"comments", "screen comments", "ScreenComment", m.MigrateScreenComments},
+		{"hotspotTemplates", "hotspot templates", "HotspotTemplate", m.MigrateHotspotTemplates},
+		{"hotspots", "hotspots", "Hotspot", m.MigrateHotspots},
+		{"links", "project links", "ProjectLink", m.MigrateLinks},
+		{"notifications", "unread notifications", "UserScreenCommentRel", m.MigrateNotifications},
+	}
+}
+
+// idPrefix returns the configured record id prefix of the current source
+// (default to [v2Prefix]).
+func (m *Migrator) idPrefix() string {
+	if m.config.IdPrefix != "" {
+		return m.config.IdPrefix
+	}
+
+	return v2Prefix
+}
+
+// userRecordId returns the v3 users record id of the specified v2 user
+// (or the id of the existing v3 user it was merged with)
+// and reports whether it is known.
+func (m *Migrator) userRecordId(v2UserId int) (string, bool) {
+	if id, ok := m.mergedUsers[v2UserId]; ok {
+		return id, true
 	}
-	itemId += fmt.Sprintf("%d", item.Id)
 
-	return itemId
+	return m.findRecordId("User", v2UserId)
 }
 
 // initRecordToMigrate initializes a core.Record for migration (either new or for update).
 //
 // Returns nil if the record is already migrated and doesn't need resave.
-func (m *Migrator) initRecordToMigrate(collection *core.Collection, item baseModel, optIdPrefixes ...string) *core.Record {
-	id := m.buildRecordId(item, optIdPrefixes...)
+func (m *Migrator) initRecordToMigrate(collection *core.Collection, table string, item baseModel) *core.Record {
+	id := m.buildRecordId(table, item)
 
 	record, _ := m.pbApp.FindRecordById(collection, id)
 	if record != nil {
@@ -235,7 +337,7 @@ func (m *Migrator) isNotEmptyCollection(collection *core.Collection) bool {
 		Limit(1).
 		Row(&exists)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		color.Yellow("--WARN[%s]: failed to check whether the collection has any records - %s", collection.Name, err)
+		m.logger.Warn("Failed to check whether the collection has any records", "step", collection.Name, "error", err)
 	}
 
 	return err == nil && exists
@@ -244,15 +346,23 @@ func (m *Migrator) isNotEmptyCollection(collection *core.Collection) bool {
 // deleteMissingRecords deletes all records from the provided collection
 // that doesn't exist in the insertedIds slice.
 //
-// This method is no-op if the insertedIds slice is empty.
+// Only the records with the current source id prefix are checked
+// so that the records migrated from other sources are left untouched.
+//
+// This method is no-op if the insertedIds slice is empty
+// or when only the quarantined rows are retried.
 //
 // Note that in case of an individual delete Record error,
-// the error is considered non-critical and will be just logged to the stderr.
+// the error is considered non-critical and will be just logged.
 func (m *Migrator) deleteMissingRecords(collection *core.Collection, insertedIds []string) error {
 	if len(insertedIds) == 0 {
 		return nil // nothing previously inserted to compare with
 	}
 
+	if m.retryRows != nil {
+		return nil // partial run
+	}
+
 	if err := m.createTempIdsTable(insertedIds); err != nil {
 		return err
 	}
@@ -262,6 +372,7 @@ func (m *Migrator) deleteMissingRecords(collection *core.Collection, insertedIds
 
 	err := m.pbApp.RecordQuery(collection).
 		AndWhere(dbx.NewExp("id NOT IN (SELECT temp_ids.id FROM temp_ids)")).
+		AndWhere(m.sourceRecordsExp()).
 		All(&records)
 	if err != nil {
 		return fmt.Errorf("failed to fetch records to remove: %w", err)
@@ -270,7 +381,7 @@ func (m *Migrator) deleteMissingRecords(collection *core.Collection, insertedIds
 	for _, r := range records {
 		if err := m.pbApp.Delete(r); err != nil {
 			// ignore the error and log only for debug
-			color.Yellow("--WARN[%s]: Failed to delete previously inserted record %q (raw error: %s)", collection.Name, r.Id, err)
+			m.logger.Warn("Failed to delete previously inserted record", "step", collection.Name, "v3Id", r.Id, "error", err)
 		}
 	}
 
@@ -279,9 +390,12 @@ func (m *Migrator) deleteMissingRecords(collection *core.Collection, insertedIds
 
 // batchCopyFiles copies all the specified files from the configured v2 to v3 storage location.
 //
-// Note: copy errors are treated as non-critical and only logged because it is possible
-// that there could be some missing/removed files as a result from v1/v2 failed screen upload/delete.
-func (m *Migrator) batchCopyFiles(files map[string]string, batchSize int, errLogGroup string) error {
+// Copy errors are handled according to the configured fileCopyPolicy (see [Migrator.handleFileCopyError]).
+// By default they are treated as non-critical because it is possible that there could be
+// some missing/removed files as a result from v1/v2 failed screen upload/delete.
+// The non-missing failed files are queued for one more retry
+// at the end of the migration (see [Migrator.RetryFailedFiles]).
+func (m *Migrator) batchCopyFiles(files map[string]string, batchSize int, step string) error {
 	var copyGroup errgroup.Group
 
 	copyGroup.SetLimit(batchSize)
@@ -291,9 +405,12 @@ func (m *Migrator) batchCopyFiles(files map[string]string, batchSize int, errLog
 		new := new
 		copyGroup.Go(func() error {
 			if err := m.copyFile(old, new); err != nil {
-				// ignore the error and log only for debug
-				color.Yellow("--WARN[%s]: Failed to copy file %q to %q (raw error: %s)", errLogGroup, old, new, err)
+				return m.handleFileCopyError(failedFile{Step: step, OldKey: old, NewKey: new}, err, false)
 			}
+
+			m.fileStats.addCopied(false)
+			m.logger.Debug("Copied file", "step", step, "fileKey", old, "newFileKey", new)
+
 			return nil
 		})
 	}
@@ -302,18 +419,50 @@ func (m *Migrator) batchCopyFiles(files map[string]string, batchSize int, errLog
 }
 
 // copyFile copies a single file from oldKey to newKey location.
+//
+// Both the read and the upload are retried on failure.
 func (m *Migrator) copyFile(oldKey string, newKey string) error {
-	oldFile, err := m.oldFS.GetFile(oldKey)
+	data, err := m.readOldFile(oldKey)
 	if err != nil {
 		return err
 	}
-	defer oldFile.Close()
 
+	return m.uploadNewFile(data, newKey)
+}
+
+// readOldFile reads the v2 file with the specified key (the read is retried on failure).
+func (m *Migrator) readOldFile(oldKey string) ([]byte, error) {
 	var buf bytes.Buffer
 
-	if _, err := oldFile.WriteTo(&buf); err != nil {
+	err := m.retry("v2 file read", func() error {
+		buf.Reset()
+
+		oldFile, err := m.oldFS.GetFile(oldKey)
+		if err != nil {
+			return err
+		}
+		defer oldFile.Close()
+
+		_, err = io.Copy(&buf, oldFile)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return m.newFS.Upload(buf.Bytes(), newKey)
+	return buf.Bytes(), nil
+}
+
+// uploadNewFile uploads data to the v3 storage at newKey (the upload is retried on failure).
+func (m *Migrator) uploadNewFile(data []byte, newKey string) error {
+	err := m.retry("v3 file upload", func() error {
+		return m.newFS.Upload(data, newKey)
+	})
+	if err != nil {
+		return &fileWriteError{err}
+	}
+
+	m.progress.addBytes(int64(len(data)))
+
+	return nil
 }
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestMigrateAll(t *testing.T) {
+	app := newTestApp(t)
+
+	config := newTestConfig(t, app)
+
+	expectedTotals := map[string]int64{
+		"users":                  2,
+		"projects":               1,
+		"projectUserPreferences": 2,
+		"prototypes":             1,
+		"screens":                2,
+		"comments":               2,
+		"hotspotTemplates":       1,
+		"hotspots":               2,
+		"links":                  1,
+		"notifications":          1,
+	}
+
+	checkTotals := func(t *testing.T, expected map[string]int64) {
+		t.Helper()
+
+		for collection, total := range expected {
+			result, err := app.CountRecords(collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != total {
+				t.Errorf("expected %d %s, got %d", total, collection, result)
+			}
+		}
+	}
+
+	// initial run
+	m := newTestMigrator(t, app, config)
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.quarantine.entries) > 0 {
+		t.Fatalf("unexpected quarantine entries %v", m.quarantine.entries)
+	}
+	checkTotals(t, expectedTotals)
+
+	prototype, err := app.FindRecordById("prototypes", "pr2_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := prototype.GetStringSlice("screensOrder"); !reflect.DeepEqual(order, []string{"pr2_2", "pr2_1"}) {
+		t.Errorf("expected screensOrder [pr2_2 pr2_1], got %v", order)
+	}
+
+	linkId, _ := m.findRecordId("ProjectLink", 1)
+	link, err := app.FindRecordById("links", linkId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username := link.GetString("username"); username != "abc123" {
+		t.Errorf("expected link username abc123, got %q", username)
+	}
+
+	// incremental run with the same data
+	m = newTestMigrator(t, app, config)
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(t, expectedTotals)
+
+	// incremental run with a deleted v2 hotspot
+	raw, err := os.ReadFile(testV2DumpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := strings.Replace(
+		string(raw),
+		`,(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',NULL,1,'back',5,5,10,10,'{}')`,
+		"",
+		1,
+	)
+	if dump == string(raw) {
+		t.Fatal("failed to remove the v2 hotspot from the dump")
+	}
+
+	config.V2DumpFile = filepath.Join(t.TempDir(), "v2dump.sql")
+	writeTestFile(t, config.V2DumpFile, []byte(dump))
+
+	m = newTestMigrator(t, app, config)
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+	expectedTotals["hotspots"] = 1
+	checkTotals(t, expectedTotals)
+
+	if _, err := app.FindRecordById("hotspots", "pr2_2"); err == nil {
+		t.Fatal("expected the deleted v2 hotspot to be removed")
+	}
+}
+
+func TestMigrateAllDanglingCascade(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestMigrator(t, app, newTestConfig(t, app))
+
+	// orphan chain: missing project 99 <- prototype 5 <- screen 7 <- comments, hotspots, ...
+	rows := []struct {
+		table  string
+		params dbx.Params
+	}{
+		{"Prototype", dbx.Params{"id": 5, "projectId": 99, "title": "Orphan", "type": "desktop", "width": 0, "height": 0, "scaleFactor": 1}},
+		{"Screen", dbx.Params{"id": 7, "prototypeId": 5, "order": 1, "title": "Orphan", "alignment": "center", "background": "#ffffff", "fixedHeader": 0, "fixedFooter": 0, "filePath": "projects/99/a.png"}},
+		{"ScreenComment", dbx.Params{"id": 10, "screenId": 7, "from": "a@example.com", "message": "a", "left": 0, "top": 0, "status": "pending"}},
+		{"ScreenComment", dbx.Params{"id": 11, "screenId": 7, "replyTo": 10, "from": "a@example.com", "message": "b", "left": 0, "top": 0, "status": "pending"}},
+		{"ScreenComment", dbx.Params{"id": 12, "screenId": 1, "replyTo": 11, "from": "a@example.com", "message": "c", "left": 0, "top": 0, "status": "pending"}},
+		{"HotspotTemplate", dbx.Params{"id": 5, "prototypeId": 5, "title": "Orphan"}},
+		{"HotspotTemplateScreenRel", dbx.Params{"id": 5, "hotspotTemplateId": 1, "screenId": 7}},
+		{"Hotspot", dbx.Params{"id": 10, "screenId": 7, "type": "back", "left": 0, "top": 0, "width": 1, "height": 1, "settings": "{}"}},
+		{"Hotspot", dbx.Params{"id": 11, "hotspotTemplateId": 5, "type": "back", "left": 0, "top": 0, "width": 1, "height": 1, "settings": "{}"}},
+		{"Hotspot", dbx.Params{"id": 12, "screenId": 1, "type": "screen", "left": 0, "top": 0, "width": 1, "height": 1, "settings": `{"screenId":7}`}},
+		{"ProjectLinkPrototypeRel", dbx.Params{"id": 5, "projectLinkId": 1, "prototypeId": 5}},
+		{"UserScreenCommentRel", dbx.Params{"id": 5, "userId": 1, "screenCommentId": 11, "isRead": 0, "isProcessed": 0}},
+	}
+	for _, row := range rows {
+		if _, err := m.oldDB.Insert(row.table, row.params).Execute(); err != nil {
+			t.Fatalf("failed to insert %s row: %v", row.table, err)
+		}
+	}
+
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range m.quarantine.entries {
+		t.Errorf("unexpected quarantine entry %s %s (%s): %s", e.Collection, e.RecordId, e.Action, e.Error)
+	}
+
+	totals := map[string]int64{
+		"prototypes":       1,
+		"screens":          2,
+		"comments":         3,
+		"hotspotTemplates": 1,
+		"hotspots":         3,
+		"notifications":    1,
+	}
+	for collection, total := range totals {
+		result, err := app.CountRecords(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != total {
+			t.Errorf("expected %d %s, got %d", total, collection, result)
+		}
+	}
+
+	// the reply to a dropped comment is migrated without replyTo
+	comment, err := app.FindRecordById("comments", "pr2_12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replyTo := comment.GetString("replyTo"); replyTo != "" {
+		t.Errorf("expected empty replyTo, got %q", replyTo)
+	}
+
+	template, err := app.FindRecordById("hotspotTemplates", "pr2_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if screens := template.GetStringSlice("screens"); len(screens) != 2 {
+		t.Errorf("expected 2 template screens, got %v", screens)
+	}
+}
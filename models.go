@@ -1,5 +1,7 @@
 package main
 
+import "reflect"
+
 type baseModel struct {
 	Id        int     `db:"id"`
 	CreatedAt *string `db:"createdAt"`
@@ -147,3 +149,62 @@ type v2UserSetting struct {
 	Name   string  `db:"name"`
 	Value  *string `db:"value"`
 }
+
+// v2Table describes a single v2 table read by the migrators.
+type v2Table struct {
+	Name  string
+	Model any
+}
+
+// v2Tables lists all v2 tables read by the migrators.
+var v2Tables = []v2Table{
+	{Name: "User", Model: v2User{}},
+	{Name: "UserAuth", Model: v2UserAuth{}},
+	{Name: "Project", Model: v2Project{}},
+	{Name: "UserProjectRel", Model: v2UserProjectRel{}},
+	{Name: "Prototype", Model: v2Prototype{}},
+	{Name: "Screen", Model: v2Screen{}},
+	{Name: "ScreenComment", Model: v2ScreenComment{}},
+	{Name: "HotspotTemplate", Model: v2HotspotTemplate{}},
+	{Name: "HotspotTemplateScreenRel", Model: v2HotspotTemplateScreenRel{}},
+	{Name: "Hotspot", Model: v2Hotspot{}},
+	{Name: "ProjectLink", Model: v2ProjectLink{}},
+	{Name: "ProjectLinkPrototypeRel", Model: v2ProjectLinkPrototypeRel{}},
+	{Name: "UserScreenCommentRel", Model: v2UserScreenCommentRel{}},
+}
+
+// Columns returns the db column names of the table model.
+func (t v2Table) Columns() []string {
+	return modelColumns(reflect.TypeOf(t.Model))
+}
+
+func modelColumns(rt reflect.Type) []string {
+	fields := modelFields(rt)
+
+	result := make([]string, len(fields))
+	for i, f := range fields {
+		result[i] = f.Tag.Get("db")
+	}
+
+	return result
+}
+
+// modelFields returns all db tagged fields of the model type (including the embedded ones).
+func modelFields(rt reflect.Type) []reflect.StructField {
+	var result []reflect.StructField
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			result = append(result, modelFields(f.Type)...)
+			continue
+		}
+
+		if tag := f.Tag.Get("db"); tag != "" && tag != "-" {
+			result = append(result, f)
+		}
+	}
+
+	return result
+}
@@ -12,6 +12,9 @@ func (m *Migrator) MigrateNotifications() error {
 		return err
 	}
 
+	progress := m.startProgress("notifications", "UserScreenCommentRel")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -21,16 +24,40 @@ func (m *Migrator) MigrateNotifications() error {
 		q := m.oldDB.Select("*").
 			From("UserScreenCommentRel").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("UserScreenCommentRel")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			userId, skip, err := m.resolveRef(refNotificationUser, "User", item.UserId)
+			if err != nil {
+				return err
+			}
+
+			var commentId string
+			if !skip {
+				commentId, skip, err = m.resolveRef(refNotificationComment, "ScreenComment", item.ScreenCommentId)
+				if err != nil {
+					return err
+				}
+			}
+
+			if skip {
+				continue // dangling reference
+			}
+
+			insertedIds = append(insertedIds, m.buildRecordId("UserScreenCommentRel", item.baseModel))
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			record := m.initRecordToMigrate(collection, "UserScreenCommentRel", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -41,13 +68,15 @@ func (m *Migrator) MigrateNotifications() error {
 			updatedAt, _ := types.ParseDateTime(item.UpdatedAt)
 			record.SetRaw("updated", updatedAt)
 
-			record.Set("user", fmt.Sprintf("%s%d", v2Prefix, item.UserId))
-			record.Set("comment", fmt.Sprintf("%s%d", v2Prefix, item.ScreenCommentId))
+			record.Set("user", userId)
+			record.Set("comment", commentId)
 			record.Set("read", item.IsRead)
 			record.Set("processed", item.IsProcessed)
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("notifications", "UserScreenCommentRel", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -15,17 +15,26 @@ func (m *Migrator) MigrateUsersOAuth2() error {
 		return err
 	}
 
+	progress := m.startProgress("oauth2", "UserAuth")
+	defer progress.finish()
+
 	// check for older duplicates to ignore from the import
 	// (in PocketBase a single auth record can be linked to only one OAuth2 account from the same provider).
 	toIgnore := []string{}
-	toIgnoreErr := m.oldDB.Select("min(id)").
-		From("UserAuth").
-		GroupBy("userId", "source").
-		Having(dbx.NewExp("count(id) > 1")).
-		Column(&toIgnore)
+	toIgnoreErr := m.retry("v2 relation query", func() error {
+		toIgnore = toIgnore[:0]
+		return m.oldDB.Select("min(id)").
+			From("UserAuth").
+			GroupBy("userId", "source").
+			Having(dbx.NewExp("count(id) > 1")).
+			Column(&toIgnore)
+	})
 	if toIgnoreErr != nil {
 		return fmt.Errorf("failed to fetch UserAuth duplicates: %w", toIgnoreErr)
 	}
+	for _, id := range toIgnore {
+		m.logger.Warn("Skipped duplicated OAuth2 rel", "step", "oauth2", "v2Id", id)
+	}
 
 	limit := 1000
 	items := make([]*v2UserAuth, 0, limit)
@@ -34,14 +43,43 @@ func (m *Migrator) MigrateUsersOAuth2() error {
 			From("UserAuth").
 			OrderBy("id asc").
 			Where(dbx.NotIn("id", list.ToInterfaceSlice(toIgnore)...)).
+			AndWhere(m.quarantinedRowsExp("UserAuth")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			itemId := fmt.Sprintf("%s%d", v2Prefix, item.Id)
+			progress.add(1)
+
+			// an external auth without a user is useless so it is always skipped (unless the policy is "fail")
+			userId, _, err := m.resolveRef(refOAuth2User, "User", item.UserId)
+			if err != nil {
+				return err
+			}
+			if userId == "" {
+				continue // dangling reference
+			}
+
+			itemId := m.buildRecordId("UserAuth", item.baseModel)
+
+			if _, merged := m.mergedUsers[item.UserId]; merged {
+				// the merged v3 user could be already linked to the same provider
+				existing, _ := m.pbApp.FindFirstExternalAuthByExpr(dbx.HashExp{
+					"collectionRef": collection.Id,
+					"recordRef":     userId,
+					"provider":      item.Source,
+				})
+				if existing != nil && existing.Id != itemId {
+					m.logger.Warn("Skipped OAuth2 rel of a merged user already linked to the same provider", "step", "oauth2", "v2Id", item.Id, "v3Id", existing.Id)
+					continue
+				}
+			}
 
 			var ea *core.ExternalAuth
 			if ea, _ = m.pbApp.FindFirstExternalAuthByExpr(dbx.HashExp{"id": itemId}); ea != nil {
@@ -63,12 +101,14 @@ func (m *Migrator) MigrateUsersOAuth2() error {
 			ea.SetRaw("updated", updatedAt)
 
 			ea.SetCollectionRef(collection.Id)
-			ea.SetRecordRef(fmt.Sprintf("%s%d", v2Prefix, item.UserId))
+			ea.SetRecordRef(userId)
 			ea.SetProvider(item.Source)
 			ea.SetProviderId(item.SourceId)
 
-			if err := m.pbApp.SaveNoValidate(ea); err != nil {
-				return fmt.Errorf("failed to save %q: %w", ea.Id, err)
+			if _, err := m.saveRecord(ea.Record); err != nil {
+				if err := m.quarantineRow("oauth2", "UserAuth", item.Id, item, fmt.Errorf("failed to save %q: %w", ea.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
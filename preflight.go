@@ -0,0 +1,357 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// stringFieldTypes lists the v3 field types that could hold a plain string value.
+var stringFieldTypes = []string{
+	core.FieldTypeText,
+	core.FieldTypeEditor,
+	core.FieldTypeSelect,
+	core.FieldTypeEmail,
+	core.FieldTypeURL,
+}
+
+// v3Field describes a single v3 collection field the migrators write to.
+type v3Field struct {
+	Name string
+
+	// Types lists the allowed field types (empty means any).
+	Types []string
+
+	// Relation is the name of the related collection
+	// (applicable only for relation fields).
+	Relation string
+}
+
+// v3Collection describes a single v3 collection the migrators write to.
+type v3Collection struct {
+	Name   string
+	Type   string
+	Fields []v3Field
+}
+
+// v3Schema lists the v3 collections and fields that are expected by the migrators.
+var v3Schema = []v3Collection{
+	{
+		Name: "users",
+		Type: core.CollectionTypeAuth,
+		Fields: []v3Field{
+			{Name: "username", Types: stringFieldTypes},
+			{Name: "name", Types: stringFieldTypes},
+			{Name: "avatar", Types: []string{core.FieldTypeFile}},
+			{Name: "allowEmailNotifications", Types: []string{core.FieldTypeBool}},
+		},
+	},
+	{
+		Name: "projects",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "title", Types: stringFieldTypes},
+			{Name: "archived", Types: []string{core.FieldTypeBool}},
+			{Name: "users", Types: []string{core.FieldTypeRelation}, Relation: "users"},
+		},
+	},
+	{
+		Name: "projectUserPreferences",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "user", Types: []string{core.FieldTypeRelation}, Relation: "users"},
+			{Name: "project", Types: []string{core.FieldTypeRelation}, Relation: "projects"},
+			{Name: "watch", Types: []string{core.FieldTypeBool}},
+			{Name: "favorite", Types: []string{core.FieldTypeBool}},
+		},
+	},
+	{
+		Name: "prototypes",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "project", Types: []string{core.FieldTypeRelation}, Relation: "projects"},
+			{Name: "title", Types: stringFieldTypes},
+			{Name: "scale", Types: []string{core.FieldTypeNumber}},
+			{Name: "size", Types: stringFieldTypes},
+			{Name: "screensOrder", Types: []string{core.FieldTypeRelation}, Relation: "screens"},
+		},
+	},
+	{
+		Name: "screens",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "prototype", Types: []string{core.FieldTypeRelation}, Relation: "prototypes"},
+			{Name: "title", Types: stringFieldTypes},
+			{Name: "alignment", Types: stringFieldTypes},
+			{Name: "background", Types: stringFieldTypes},
+			{Name: "fixedHeader", Types: []string{core.FieldTypeNumber}},
+			{Name: "fixedFooter", Types: []string{core.FieldTypeNumber}},
+			{Name: "file", Types: []string{core.FieldTypeFile}},
+		},
+	},
+	{
+		Name: "comments",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "screen", Types: []string{core.FieldTypeRelation}, Relation: "screens"},
+			{Name: "replyTo", Types: []string{core.FieldTypeRelation}, Relation: "comments"},
+			{Name: "user", Types: []string{core.FieldTypeRelation}, Relation: "users"},
+			{Name: "guestEmail", Types: stringFieldTypes},
+			{Name: "message", Types: stringFieldTypes},
+			{Name: "left", Types: []string{core.FieldTypeNumber}},
+			{Name: "top", Types: []string{core.FieldTypeNumber}},
+			{Name: "resolved", Types: []string{core.FieldTypeBool}},
+		},
+	},
+	{
+		Name: "hotspotTemplates",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "prototype", Types: []string{core.FieldTypeRelation}, Relation: "prototypes"},
+			{Name: "screens", Types: []string{core.FieldTypeRelation}, Relation: "screens"},
+			{Name: "title", Types: stringFieldTypes},
+		},
+	},
+	{
+		Name: "hotspots",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "screen", Types: []string{core.FieldTypeRelation}, Relation: "screens"},
+			{Name: "hotspotTemplate", Types: []string{core.FieldTypeRelation}, Relation: "hotspotTemplates"},
+			{Name: "type", Types: stringFieldTypes},
+			{Name: "left", Types: []string{core.FieldTypeNumber}},
+			{Name: "top", Types: []string{core.FieldTypeNumber}},
+			{Name: "width", Types: []string{core.FieldTypeNumber}},
+			{Name: "height", Types: []string{core.FieldTypeNumber}},
+			{Name: "settings", Types: []string{core.FieldTypeJSON}},
+		},
+	},
+	{
+		Name: "links",
+		Type: core.CollectionTypeAuth,
+		Fields: []v3Field{
+			{Name: "project", Types: []string{core.FieldTypeRelation}, Relation: "projects"},
+			{Name: "username", Types: stringFieldTypes},
+			{Name: "allowComments", Types: []string{core.FieldTypeBool}},
+			{Name: "passwordProtect", Types: []string{core.FieldTypeBool}},
+			{Name: "onlyPrototypes", Types: []string{core.FieldTypeRelation}, Relation: "prototypes"},
+		},
+	},
+	{
+		Name: "notifications",
+		Type: core.CollectionTypeBase,
+		Fields: []v3Field{
+			{Name: "user", Types: []string{core.FieldTypeRelation}, Relation: "users"},
+			{Name: "comment", Types: []string{core.FieldTypeRelation}, Relation: "comments"},
+			{Name: "read", Types: []string{core.FieldTypeBool}},
+			{Name: "processed", Types: []string{core.FieldTypeBool}},
+		},
+	},
+}
+
+// Preflight checks whether the v2 and v3 schemas are compatible
+// with the migrators before any records are written.
+func (m *Migrator) Preflight() error {
+	m.logger.Info("Checking Presentator v2 schema...", "driver", m.oldDB.DriverName(), "lastMigration", m.lastV2Migration())
+
+	v2Problems, err := m.checkV2Schema()
+	if err != nil {
+		return fmt.Errorf("failed to inspect the Presentator v2 schema: %w", err)
+	}
+	if len(v2Problems) > 0 {
+		return fmt.Errorf("incompatible Presentator v2 schema:\n  - %s", strings.Join(v2Problems, "\n  - "))
+	}
+
+	m.logger.Info("Checking Presentator v3 schema...", "pocketbase", pocketbase.Version, "lastMigration", m.lastV3Migration())
+
+	v3Problems := m.checkV3Schema()
+	if len(v3Problems) > 0 {
+		return fmt.Errorf("incompatible Presentator v3 schema:\n  - %s", strings.Join(v3Problems, "\n  - "))
+	}
+
+	return nil
+}
+
+// checkV2Schema compares the v2 db tables with [v2Tables]
+// and returns a list with all missing tables and columns.
+//
+// Unknown columns (eg. leftovers from a v1 upgrade) are not considered
+// an error and are only logged because they are ignored by the migrators.
+func (m *Migrator) checkV2Schema() ([]string, error) {
+	existing, err := m.v2SchemaColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	for _, table := range v2Tables {
+		columns, ok := existing[m.normalizeV2TableName(table.Name)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing table %q", table.Name))
+			continue
+		}
+
+		expected := table.Columns()
+
+		for _, col := range expected {
+			if !slices.Contains(columns, col) {
+				problems = append(problems, fmt.Sprintf("missing column %s.%s", table.Name, col))
+			}
+		}
+
+		var unknown []string
+		for _, col := range columns {
+			if !slices.Contains(expected, col) {
+				unknown = append(unknown, col)
+			}
+		}
+		if len(unknown) > 0 {
+			m.logger.Warn("Unknown v2 columns will be ignored", "table", table.Name, "columns", strings.Join(unknown, ", "))
+		}
+	}
+
+	return problems, nil
+}
+
+// v2SchemaColumns returns the column names of all v2 db tables
+// grouped by their table name.
+func (m *Migrator) v2SchemaColumns() (map[string][]string, error) {
+	var query string
+
+	switch driver := m.oldDB.DriverName(); driver {
+	case "mysql":
+		query = "SELECT TABLE_NAME AS tableName, COLUMN_NAME AS columnName FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE()"
+	case "pgx":
+		query = `SELECT table_name AS "tableName", column_name AS "columnName" FROM information_schema.columns WHERE table_schema = current_schema()`
+	case "sqlite":
+		// v2DumpFile store
+		query = "SELECT m.name AS tableName, p.name AS columnName FROM sqlite_master m JOIN pragma_table_info(m.name) p WHERE m.type = 'table'"
+	default:
+		return nil, fmt.Errorf("unsupported v2 db driver %q", driver)
+	}
+
+	rows := []struct {
+		TableName  string `db:"tableName"`
+		ColumnName string `db:"columnName"`
+	}{}
+
+	if err := m.oldDB.NewQuery(query).All(&rows); err != nil {
+		return nil, err
+	}
+
+	result := map[string][]string{}
+
+	for _, row := range rows {
+		table := m.normalizeV2TableName(row.TableName)
+		result[table] = append(result[table], row.ColumnName)
+	}
+
+	return result, nil
+}
+
+// normalizeV2TableName normalizes the provided table name for comparison.
+//
+// MySQL table names could be case insensitive depending on the OS and
+// the lower_case_table_names setting so they are always lowercased.
+func (m *Migrator) normalizeV2TableName(name string) string {
+	if m.oldDB.DriverName() == "mysql" {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// lastV2Migration returns the last applied v2 (Yii2) migration version
+// (it is used as an indicator for the Presentator v2 schema version).
+func (m *Migrator) lastV2Migration() string {
+	var version string
+
+	err := m.oldDB.Select("version").
+		From("migration").
+		OrderBy("apply_time DESC", "version DESC").
+		Limit(1).
+		Row(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.logger.Warn("Failed to detect the last applied v2 migration", "error", err)
+	}
+
+	if version == "" {
+		return "unknown"
+	}
+
+	return version
+}
+
+// checkV3Schema compares the pb_data collections with [v3Schema]
+// and returns a list with all found incompatibilities.
+func (m *Migrator) checkV3Schema() []string {
+	var problems []string
+
+	for _, expected := range v3Schema {
+		collection, err := m.pbApp.FindCollectionByNameOrId(expected.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("missing collection %q", expected.Name))
+			continue
+		}
+
+		if collection.Type != expected.Type {
+			problems = append(problems, fmt.Sprintf("collection %q must be of type %q, got %q", expected.Name, expected.Type, collection.Type))
+		}
+
+		for _, ef := range expected.Fields {
+			field := collection.Fields.GetByName(ef.Name)
+			if field == nil {
+				problems = append(problems, fmt.Sprintf("missing field %s.%s", expected.Name, ef.Name))
+				continue
+			}
+
+			if len(ef.Types) > 0 && !slices.Contains(ef.Types, field.Type()) {
+				problems = append(problems, fmt.Sprintf("field %s.%s must be of type %s, got %q", expected.Name, ef.Name, strings.Join(ef.Types, "|"), field.Type()))
+				continue
+			}
+
+			if ef.Relation == "" {
+				continue
+			}
+
+			relField, ok := field.(*core.RelationField)
+			if !ok {
+				continue
+			}
+
+			relCollection, err := m.pbApp.FindCollectionByNameOrId(ef.Relation)
+			if err != nil || relCollection.Id != relField.CollectionId {
+				problems = append(problems, fmt.Sprintf("field %s.%s must be a relation to %q", expected.Name, ef.Name, ef.Relation))
+			}
+		}
+	}
+
+	return problems
+}
+
+// lastV3Migration returns the name of the last applied pb_data migration
+// (it is used as an indicator for the Presentator v3 schema version).
+func (m *Migrator) lastV3Migration() string {
+	var file string
+
+	err := m.pbApp.DB().Select("file").
+		From(core.DefaultMigrationsTable).
+		OrderBy("applied DESC", "file DESC").
+		Limit(1).
+		Row(&file)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.logger.Warn("Failed to detect the last applied v3 migration", "error", err)
+	}
+
+	if file == "" {
+		return "unknown"
+	}
+
+	return file
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestCheckV3Schema(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		change   func(app core.App) error
+		expected []string
+	}{
+		{
+			"compatible schema",
+			func(app core.App) error { return nil },
+			nil,
+		},
+		{
+			"missing collection",
+			func(app core.App) error {
+				collection, err := app.FindCollectionByNameOrId("notifications")
+				if err != nil {
+					return err
+				}
+				return app.Delete(collection)
+			},
+			[]string{`missing collection "notifications"`},
+		},
+		{
+			"missing field",
+			func(app core.App) error {
+				collection, err := app.FindCollectionByNameOrId("projects")
+				if err != nil {
+					return err
+				}
+				collection.Fields.RemoveByName("title")
+				return app.Save(collection)
+			},
+			[]string{"missing field projects.title"},
+		},
+		{
+			"incompatible field type",
+			func(app core.App) error {
+				collection, err := app.FindCollectionByNameOrId("prototypes")
+				if err != nil {
+					return err
+				}
+				collection.Fields.RemoveByName("scale")
+				collection.Fields.Add(&core.TextField{Name: "scale"})
+				return app.Save(collection)
+			},
+			[]string{`field prototypes.scale must be of type number, got "text"`},
+		},
+		{
+			"relation to another collection",
+			func(app core.App) error {
+				collection, err := app.FindCollectionByNameOrId("links")
+				if err != nil {
+					return err
+				}
+				users, err := app.FindCollectionByNameOrId("users")
+				if err != nil {
+					return err
+				}
+				collection.Fields.RemoveByName("project")
+				if err := app.Save(collection); err != nil {
+					return err
+				}
+				collection.Fields.Add(&core.RelationField{Name: "project", CollectionId: users.Id, MaxSelect: 1})
+				return app.Save(collection)
+			},
+			[]string{`field links.project must be a relation to "projects"`},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app := newTestApp(t)
+
+			if err := s.change(app); err != nil {
+				t.Fatal(err)
+			}
+
+			m := &Migrator{pbApp: app}
+
+			problems := m.checkV3Schema()
+			if strings.Join(problems, "\n") != strings.Join(s.expected, "\n") {
+				t.Fatalf("expected problems %q, got %q", s.expected, problems)
+			}
+		})
+	}
+}
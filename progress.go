@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	progressBarWidth       = 30
+	progressTTYInterval    = 200 * time.Millisecond
+	progressNonTTYInterval = 10 * time.Second
+)
+
+// progress tracks and periodically prints the progress of a single migration step.
+//
+// On a TTY the progress is printed as a live bar, otherwise as periodic info log lines.
+type progress struct {
+	step   string
+	total  int64
+	rows   atomic.Int64
+	bytes  atomic.Int64
+	start  time.Time
+	logger *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startProgress counts the rows of the provided v2 table and starts
+// reporting the progress of the specified migration step.
+//
+// The returned progress is also registered as the current Migrator
+// progress so that the copied files bytes can be tracked.
+//
+// NB! Don't forget to call [progress.finish()] once the step is done.
+func (m *Migrator) startProgress(step string, table string) *progress {
+	var total int64
+	if err := m.oldDB.Select("count(*)").From(table).Row(&total); err != nil {
+		m.logger.Warn("Failed to count the v2 rows", "step", step, "table", table, "error", err)
+	}
+
+	return m.startProgressWithTotal(step, total)
+}
+
+// startProgressWithTotal is similar to [Migrator.startProgress]
+// but with an explicit total (eg. for the steps that iterate over the v3 records).
+func (m *Migrator) startProgressWithTotal(step string, total int64) *progress {
+	p := &progress{
+		step:   step,
+		total:  total,
+		start:  time.Now(),
+		logger: m.logger,
+		stop:   make(chan struct{}),
+	}
+
+	interval := progressNonTTYInterval
+	if stdout.tty {
+		interval = progressTTYInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.print()
+			}
+		}
+	}()
+
+	m.progress = p
+
+	return p
+}
+
+// add increments the processed rows counter.
+func (p *progress) add(rows int) {
+	if p != nil {
+		p.rows.Add(int64(rows))
+	}
+}
+
+// addBytes increments the copied bytes counter.
+func (p *progress) addBytes(n int64) {
+	if p != nil {
+		p.bytes.Add(n)
+	}
+}
+
+// finish stops the periodic reporting and prints the final step progress.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+
+	close(p.stop)
+	p.wg.Wait()
+
+	p.print()
+
+	stdout.endBar()
+}
+
+// print prints the current step progress.
+func (p *progress) print() {
+	rows := p.rows.Load()
+	elapsed := time.Since(p.start)
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(rows) / elapsed.Seconds()
+	}
+
+	eta := "-"
+	if rate > 0 && p.total > rows {
+		eta = time.Duration(float64(p.total-rows) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	if !stdout.tty {
+		p.logger.Info(
+			"Progress",
+			"step", p.step,
+			"rows", rows,
+			"total", p.total,
+			"rowsPerSecond", int64(rate),
+			"bytes", p.bytes.Load(),
+			"elapsed", elapsed.Round(time.Second).String(),
+			"eta", eta,
+		)
+		return
+	}
+
+	var ratio float64
+	if p.total > 0 {
+		ratio = min(float64(rows)/float64(p.total), 1)
+	}
+	filled := int(ratio * progressBarWidth)
+
+	stdout.writeBar(fmt.Sprintf(
+		"%s [%s%s] %3.0f%% %d/%d rows, %.0f rows/s, %s copied, elapsed %s, ETA %s",
+		p.step,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		ratio*100,
+		rows,
+		p.total,
+		rate,
+		formatBytes(p.bytes.Load()),
+		elapsed.Round(time.Second),
+		eta,
+	))
+}
+
+// formatBytes returns a human readable representation of the provided bytes size.
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -13,6 +13,9 @@ func (m *Migrator) MigrateProjects() error {
 		return err
 	}
 
+	progress := m.startProgress("projects", "Project")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -22,16 +25,23 @@ func (m *Migrator) MigrateProjects() error {
 		q := m.oldDB.Select("*").
 			From("Project").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("Project")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			insertedIds = append(insertedIds, m.buildRecordId("Project", item.baseModel))
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			record := m.initRecordToMigrate(collection, "Project", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -47,12 +57,17 @@ func (m *Migrator) MigrateProjects() error {
 
 			userIds, err := m.getPrefixedProjectUserIds(item.Id)
 			if err != nil {
-				return err
+				if err := m.quarantineRow("projects", "Project", item.Id, item, err); err != nil {
+					return err
+				}
+				continue
 			}
 			record.Set("users", userIds)
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			if _, err := m.saveRecord(record); err != nil {
+				if err := m.quarantineRow("projects", "Project", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -73,18 +88,28 @@ func (m *Migrator) MigrateProjects() error {
 func (m *Migrator) getPrefixedProjectUserIds(projectId int) ([]string, error) {
 	var ids []int
 
-	err := m.oldDB.Select("userId").
-		From("UserProjectRel").
-		AndWhere(dbx.HashExp{"projectId": projectId}).
-		Column(&ids)
+	err := m.retry("v2 relation query", func() error {
+		ids = nil
+		return m.oldDB.Select("userId").
+			From("UserProjectRel").
+			AndWhere(dbx.HashExp{"projectId": projectId}).
+			Column(&ids)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]string, len(ids))
+	result := make([]string, 0, len(ids))
 
-	for i, id := range ids {
-		result[i] = fmt.Sprintf("%s%d", v2Prefix, id)
+	for _, id := range ids {
+		// for the relation rows both drop and null remove only the dangling id
+		userId, _, err := m.resolveRef(refProjectUser, "User", id)
+		if err != nil {
+			return nil, err
+		}
+		if userId != "" {
+			result = append(result, userId)
+		}
 	}
 
 	return result, nil
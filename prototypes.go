@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/tools/types"
@@ -14,6 +15,9 @@ func (m *Migrator) MigratePrototypes() error {
 		return err
 	}
 
+	progress := m.startProgress("prototypes", "Prototype")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -23,16 +27,31 @@ func (m *Migrator) MigratePrototypes() error {
 		q := m.oldDB.Select("*").
 			From("Prototype").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("Prototype")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			projectId, skip, err := m.resolveRef(refPrototypeProject, "Project", item.ProjectId)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue // dangling reference
+			}
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			insertedIds = append(insertedIds, m.buildRecordId("Prototype", item.baseModel))
+
+			record := m.initRecordToMigrate(collection, "Prototype", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -43,7 +62,7 @@ func (m *Migrator) MigratePrototypes() error {
 			updatedAt, _ := types.ParseDateTime(item.UpdatedAt)
 			record.SetRaw("updated", updatedAt)
 
-			record.Set("project", fmt.Sprintf("%s%d", v2Prefix, item.ProjectId))
+			record.Set("project", projectId)
 			record.Set("scale", item.ScaleFactor)
 			if item.Type != "desktop" {
 				record.Set("size", fmt.Sprintf("%dx%d", cast.ToInt(item.Width), cast.ToInt(item.Height)))
@@ -51,7 +70,10 @@ func (m *Migrator) MigratePrototypes() error {
 
 			screensOrder, err := m.getPrefixedScreensOrder(item.Id)
 			if err != nil {
-				return err
+				if err := m.quarantineRow("prototypes", "Prototype", item.Id, item, fmt.Errorf("failed to load the screens order of %q: %w", record.Id, err)); err != nil {
+					return err
+				}
+				continue
 			}
 			record.Set("screensOrder", screensOrder)
 
@@ -71,8 +93,11 @@ func (m *Migrator) MigratePrototypes() error {
 				}
 			}
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+			// exclude screensOrder from the validation since the screens are not migrated yet
+			if _, err := m.saveRecord(record, "screensOrder"); err != nil {
+				if err := m.quarantineRow("prototypes", "Prototype", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err)); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -93,20 +118,83 @@ func (m *Migrator) MigratePrototypes() error {
 func (m *Migrator) getPrefixedScreensOrder(prototypeId int) ([]string, error) {
 	var screenIds []int
 
-	err := m.oldDB.Select("id").
-		From("Screen").
-		AndWhere(dbx.HashExp{"prototypeId": prototypeId}).
-		OrderBy("[[order]] ASC").
-		Column(&screenIds)
+	err := m.retry("v2 relation query", func() error {
+		screenIds = nil
+		return m.oldDB.Select("id").
+			From("Screen").
+			AndWhere(dbx.HashExp{"prototypeId": prototypeId}).
+			OrderBy("[[order]] ASC").
+			Column(&screenIds)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]string, len(screenIds))
+	result := make([]string, 0, len(screenIds))
 
-	for i, id := range screenIds {
-		result[i] = fmt.Sprintf("%s%d", v2Prefix, id)
+	// the screens are migrated after the prototypes so with opaqueIds
+	// the not yet known ids are filled later by [Migrator.syncScreensOrder]
+	for _, id := range screenIds {
+		if screenId, ok := m.findRecordId("Screen", id); ok {
+			result = append(result, screenId)
+		}
 	}
 
 	return result, nil
 }
+
+// syncScreensOrder refreshes the screensOrder of the migrated prototypes
+// with the ids of the screens that were not known during the prototypes step
+// (the opaque screen ids are generated only when the screens are migrated).
+func (m *Migrator) syncScreensOrder() error {
+	limit := 1000
+	ids := make([]int, 0, limit)
+	for i := 0; ; i++ {
+		q := m.oldDB.Select("id").
+			From("Prototype").
+			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("Prototype")).
+			Limit(int64(limit)).
+			Offset(int64(i * limit))
+		err := m.retry("v2 query", func() error {
+			ids = ids[:0]
+			return q.Column(&ids)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v2Id := range ids {
+			prototypeId, ok := m.findRecordId("Prototype", v2Id)
+			if !ok {
+				continue // not migrated
+			}
+
+			record, err := m.pbApp.FindRecordById("prototypes", prototypeId)
+			if err != nil {
+				continue // not migrated
+			}
+
+			screensOrder, err := m.getPrefixedScreensOrder(v2Id)
+			if err != nil {
+				return fmt.Errorf("failed to fetch the screens order of prototype %q: %w", prototypeId, err)
+			}
+
+			if slices.Equal(record.GetStringSlice("screensOrder"), screensOrder) {
+				continue
+			}
+
+			record.Set("screensOrder", screensOrder)
+
+			if err := m.pbApp.SaveNoValidate(record); err != nil {
+				return fmt.Errorf("failed to update the screens order of prototype %q: %w", prototypeId, err)
+			}
+		}
+
+		if len(ids) < limit {
+			break // no more items
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/list"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// quarantineCollectionName is the pb_data collection with the failed v2 rows.
+const quarantineCollectionName = "_migrationQuarantine"
+
+// defaultMaxRowErrors is the default max number of quarantined failed v2 rows per run.
+const defaultMaxRowErrors = 100
+
+// quarantineRow isolates a single failed v2 row so that the step could continue with the next one.
+//
+// The row is stored in the [quarantineCollectionName] collection together with its error
+// (see also [Migrator.RetryQuarantine]).
+//
+// Returns a non-nil error if the migration should be stopped
+// (the maxRowErrors limit is exceeded or the row isolation is disabled).
+func (m *Migrator) quarantineRow(step string, table string, v2Id int, row any, rowErr error) error {
+	maxErrors := m.config.MaxRowErrors
+	if maxErrors == 0 {
+		maxErrors = defaultMaxRowErrors
+	}
+	if maxErrors < 0 {
+		return rowErr
+	}
+
+	rawRow, err := json.Marshal(row)
+	if err != nil {
+		rawRow = []byte("null")
+	}
+
+	err = m.pbApp.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().Delete(quarantineCollectionName, dbx.HashExp{
+			"source":  m.idPrefix(),
+			"v2Table": table,
+			"v2Id":    v2Id,
+		}).Execute()
+		if err != nil {
+			return err
+		}
+
+		_, err = txApp.DB().Insert(quarantineCollectionName, dbx.Params{
+			"id":      core.GenerateDefaultRandomId(),
+			"source":  m.idPrefix(),
+			"step":    step,
+			"v2Table": table,
+			"v2Id":    v2Id,
+			"error":   rowErr.Error(),
+			"rawRow":  string(rawRow),
+			"created": types.NowDateTime().String(),
+		}).Execute()
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine %s row %d: %w; %w", table, v2Id, err, rowErr)
+	}
+
+	m.failedRows++
+
+	m.logger.Warn("Quarantined failed row", "step", step, "v2Id", v2Id, "error", rowErr)
+
+	if m.failedRows > maxErrors {
+		return fmt.Errorf("too many failed rows (%d, maxRowErrors %d): %w", m.failedRows, maxErrors, rowErr)
+	}
+
+	return nil
+}
+
+// RetryQuarantine re-runs the migration steps only for the quarantined v2 rows
+// of the current source (eg. once they are fixed in v2).
+//
+// The rows that fail again are kept in the quarantine.
+func (m *Migrator) RetryQuarantine() (err error) {
+	start := time.Now()
+
+	m.logger.Info("Presentator v2 quarantine retry started...")
+
+	m.quarantine = &quarantine{}
+	m.failedFiles = &failedFiles{}
+	m.fileStats = &fileCopyStats{}
+	m.imageStats = &imageStats{}
+	m.mergedUsers = map[int]string{}
+	m.failedRows = 0
+
+	// no pb_data writes before the preflight
+	if err := m.Preflight(); err != nil {
+		return err
+	}
+
+	if err := m.startRun(); err != nil {
+		return err
+	}
+	defer func() {
+		m.finishRun(err)
+	}()
+
+	if err := m.loadIdMap(); err != nil {
+		return err
+	}
+
+	if err := m.ensureQuarantineCollection(); err != nil {
+		return fmt.Errorf("failed to create the %s collection: %w", quarantineCollectionName, err)
+	}
+
+	if err := m.ensureFileMapCollection(); err != nil {
+		return fmt.Errorf("failed to create the %s collection: %w", fileMapCollectionName, err)
+	}
+
+	rows := []struct {
+		Id      string `db:"id"`
+		V2Table string `db:"v2Table"`
+		V2Id    int    `db:"v2Id"`
+	}{}
+	err = m.pbApp.DB().Select("id", "v2Table", "v2Id").
+		From(quarantineCollectionName).
+		AndWhere(dbx.HashExp{"source": m.idPrefix()}).
+		All(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to load the quarantined rows: %w", err)
+	}
+
+	if len(rows) == 0 {
+		m.logger.Info("There are no quarantined rows to retry.", "source", m.idPrefix())
+		return nil
+	}
+
+	m.retryRows = map[string][]int{}
+	defer func() {
+		m.retryRows = nil
+	}()
+
+	entryIds := map[string][]string{}
+	for _, row := range rows {
+		m.retryRows[row.V2Table] = append(m.retryRows[row.V2Table], row.V2Id)
+		entryIds[row.V2Table] = append(entryIds[row.V2Table], row.Id)
+	}
+
+	m.logger.Info("Checking v2 references integrity...")
+	if err := m.CheckIntegrity(); err != nil {
+		return err
+	}
+
+	// the merged users are otherwise resolved only by the users step
+	if m.config.MergeUsersByEmail {
+		if err := m.loadMergedUsers(); err != nil {
+			return fmt.Errorf("failed to load the merged users: %w", err)
+		}
+	}
+
+	for _, step := range m.migrationSteps() {
+		if len(m.retryRows[step.table]) == 0 {
+			continue
+		}
+
+		if err := m.runStep(step.name, step.title, step.fn); err != nil {
+			return err
+		}
+
+		// the rows that failed again were quarantined with new ids
+		_, err := m.pbApp.DB().Delete(
+			quarantineCollectionName,
+			dbx.In("id", list.ToInterfaceSlice(entryIds[step.table])...),
+		).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to remove the retried %s rows from the quarantine: %w", step.table, err)
+		}
+
+		if err := m.checkFileErrorRate(false); err != nil {
+			return err
+		}
+	}
+
+	if err := m.runStep("fileRetries", "failed files", m.RetryFailedFiles); err != nil {
+		return err
+	}
+
+	m.fileStats.report(m.logger)
+	if m.config.ValidateImages {
+		m.imageStats.report(m.logger)
+	}
+	m.quarantine.report(m.logger)
+	m.reportFailedRows()
+
+	m.logger.Info(
+		"Quarantine retry completed.",
+		"retried", len(rows),
+		"recovered", len(rows)-m.failedRows,
+		"elapsed", time.Since(start).String(),
+	)
+
+	return nil
+}
+
+// quarantinedRowsExp returns an expression that restricts the v2 rows of the table
+// to the quarantined ones when retrying the quarantine (see [Migrator.RetryQuarantine]).
+//
+// All rows are matched on a regular migration run.
+func (m *Migrator) quarantinedRowsExp(table string) dbx.Expression {
+	if m.retryRows == nil {
+		return dbx.NewExp("1=1")
+	}
+
+	return dbx.In("id", list.ToInterfaceSlice(m.retryRows[table])...)
+}
+
+// clearQuarantine removes all quarantined rows of the current source.
+func (m *Migrator) clearQuarantine() error {
+	_, err := m.pbApp.DB().Delete(quarantineCollectionName, dbx.HashExp{"source": m.idPrefix()}).Execute()
+	return err
+}
+
+// reportFailedRows logs the total number of quarantined failed rows of the current run.
+func (m *Migrator) reportFailedRows() {
+	if m.failedRows == 0 {
+		return
+	}
+
+	m.logger.Warn(
+		"Some v2 rows failed and were quarantined. Fix them in v2 and run the retry-quarantine command.",
+		"total", m.failedRows,
+		"collection", quarantineCollectionName,
+	)
+}
+
+func (m *Migrator) ensureQuarantineCollection() error {
+	collection, _ := m.pbApp.FindCollectionByNameOrId(quarantineCollectionName)
+	if collection != nil {
+		return nil
+	}
+
+	collection = core.NewBaseCollection(quarantineCollectionName)
+	collection.System = true
+	collection.Fields.Add(
+		&core.TextField{Name: "source"},
+		&core.TextField{Name: "step"},
+		&core.TextField{Name: "v2Table"},
+		&core.NumberField{Name: "v2Id", OnlyInt: true},
+		&core.TextField{Name: "error"},
+		&core.JSONField{Name: "rawRow"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	collection.AddIndex("idx_migrationQuarantine_row", true, "`source`, `v2Table`, `v2Id`", "")
+
+	return m.pbApp.Save(collection)
+}
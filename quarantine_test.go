@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRetryQuarantinePreflight(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestMigrator(t, app, newTestConfig(t, app))
+
+	if _, err := m.oldDB.NewQuery("ALTER TABLE Screen DROP COLUMN [[order]]").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RetryQuarantine(); err == nil {
+		t.Fatal("expected incompatible v2 schema error")
+	}
+
+	// no pb_data writes before the preflight
+	for _, name := range []string{runsCollectionName, quarantineCollectionName, fileMapCollectionName} {
+		if _, err := app.FindCollectionByNameOrId(name); err == nil {
+			t.Errorf("expected no %s collection", name)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Redirect server route kinds.
+const (
+	routeLink          = "link"
+	routeScreen        = "screen"
+	routeFile          = "file"
+	routeProject       = "project"
+	routePrototype     = "prototype"
+	routeProjectScreen = "projectScreen"
+)
+
+// redirectRoute is a single dynamic v2 path -> v3 location route of the redirect server.
+type redirectRoute struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+// RedirectServer answers the old v2 urls with permanent redirects to their v3 locations.
+type RedirectServer struct {
+	// m is a Migrator that works only with pb_data
+	// (the v2 DB and storage are not needed and could be already gone).
+	m      *Migrator
+	cfg    RedirectsConfig
+	routes []redirectRoute
+}
+
+// NewRedirectServer creates and setup a new RedirectServer instance.
+//
+// The urls are resolved first with the rules stored by the redirects command
+// and then through the migration id and file mappings.
+func NewRedirectServer(app core.App, config *Config) (*RedirectServer, error) {
+	m := &Migrator{
+		pbApp:  app,
+		config: config,
+		logger: slog.Default(),
+	}
+
+	if err := m.loadIdMap(); err != nil {
+		return nil, err
+	}
+
+	if err := m.ensureRedirectsCollection(); err != nil {
+		return nil, fmt.Errorf("failed to create the %s collection: %w", redirectsCollectionName, err)
+	}
+
+	if err := m.ensureFileMapCollection(); err != nil {
+		return nil, fmt.Errorf("failed to create the %s collection: %w", fileMapCollectionName, err)
+	}
+
+	cfg := config.Redirects.withDefaults()
+	if cfg.V3URL == "" {
+		cfg.V3URL = app.Settings().Meta.AppURL
+	}
+	if cfg.V3URL == "" {
+		return nil, errors.New("redirects.v3Url is not set and the pb_data Application URL setting is empty")
+	}
+	cfg.V3URL = strings.TrimRight(cfg.V3URL, "/")
+
+	return &RedirectServer{
+		m:   m,
+		cfg: cfg,
+		// the more specific routes first
+		routes: []redirectRoute{
+			{routeScreen, redirectPathRegex(cfg.V2ScreenPath)},
+			{routeFile, redirectPathRegex(cfg.V2FilePath)},
+			{routeLink, redirectPathRegex(cfg.V2LinkPath)},
+			{routeProjectScreen, redirectPathRegex(cfg.V2ProjectScreenPath)},
+			{routePrototype, redirectPathRegex(cfg.V2PrototypePath)},
+			{routeProject, redirectPathRegex(cfg.V2ProjectPath)},
+		},
+	}, nil
+}
+
+// Serve starts a HTTP server at addr that answers the v2 link, screen, project and file urls
+// with a 301 redirect to their v3 location until SIGINT or SIGTERM.
+func (s *RedirectServer) Serve(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	s.m.logger.Info("Redirect server started...", "addr", addr, "v3Url", s.cfg.V3URL, "source", s.m.idPrefix())
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("redirect server error: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to stop the redirect server: %w", err)
+	}
+
+	s.m.logger.Info("Redirect server stopped")
+
+	return nil
+}
+
+func (s *RedirectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	location, err := s.resolve(r.URL.EscapedPath())
+	if err != nil {
+		s.m.logger.Error("Failed to resolve redirect", "path", r.URL.Path, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if location == "" {
+		s.m.logger.Debug("No redirect found", "path", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+
+	s.m.logger.Debug("Redirected", "path", r.URL.Path, "location", location)
+
+	http.Redirect(w, r, location, http.StatusMovedPermanently)
+}
+
+// resolve returns the v3 location of the escaped v2 path or empty string if there is no match.
+func (s *RedirectServer) resolve(path string) (string, error) {
+	if path != "/" {
+		path = strings.TrimRight(path, "/")
+	}
+
+	// rules generated by the redirects command
+	var to string
+	err := s.m.pbApp.DB().Select("to").
+		From(redirectsCollectionName).
+		AndWhere(dbx.HashExp{"source": s.m.idPrefix(), "from": path}).
+		Limit(1).
+		Row(&to)
+	if err == nil {
+		return to, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	// dynamic lookups through the id and file mappings
+	for _, route := range s.routes {
+		match := route.pattern.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+
+		params := map[string]string{}
+		for i, name := range route.pattern.SubexpNames() {
+			if name != "" {
+				params[name], _ = url.PathUnescape(match[i])
+			}
+		}
+
+		location, err := s.resolveRoute(route.kind, params)
+		if err != nil || location != "" {
+			return location, err
+		}
+	}
+
+	return "", nil
+}
+
+func (s *RedirectServer) resolveRoute(kind string, params map[string]string) (string, error) {
+	switch kind {
+	case routeLink:
+		link, err := s.findLink(params["slug"])
+		if link == nil || err != nil {
+			return "", err
+		}
+
+		return s.cfg.V3URL + expandRedirectPath(s.cfg.V3LinkPath, redirectPathValues{
+			Slug: link.GetString("username"),
+		}), nil
+	case routeScreen:
+		link, err := s.findLink(params["slug"])
+		if link == nil || err != nil {
+			return "", err
+		}
+
+		screen, err := s.findRecord("screens", "Screen", params["screen"])
+		if screen == nil || err != nil {
+			return "", err
+		}
+
+		if ok, err := s.isLinkScreen(link, screen, params); !ok || err != nil {
+			return "", err
+		}
+
+		return s.cfg.V3URL + expandRedirectPath(s.cfg.V3ScreenPath, redirectPathValues{
+			Slug:      link.GetString("username"),
+			Prototype: screen.GetString("prototype"),
+			Screen:    screen.Id,
+		}), nil
+	case routeFile:
+		return s.findFileURL(params["file"])
+	case routeProject:
+		project, err := s.findRecord("projects", "Project", params["project"])
+		if project == nil || err != nil {
+			return "", err
+		}
+
+		return s.cfg.V3URL + expandRedirectPath(s.cfg.V3ProjectPath, redirectPathValues{
+			Project: project.Id,
+		}), nil
+	case routePrototype:
+		prototype, err := s.findRecord("prototypes", "Prototype", params["prototype"])
+		if prototype == nil || err != nil {
+			return "", err
+		}
+
+		return s.cfg.V3URL + expandRedirectPath(s.cfg.V3PrototypePath, redirectPathValues{
+			Project:   prototype.GetString("project"),
+			Prototype: prototype.Id,
+		}), nil
+	case routeProjectScreen:
+		screen, err := s.findRecord("screens", "Screen", params["screen"])
+		if screen == nil || err != nil {
+			return "", err
+		}
+
+		prototype, err := s.m.pbApp.FindRecordById("prototypes", screen.GetString("prototype"))
+		if err != nil {
+			return "", nil // orphaned screen
+		}
+
+		return s.cfg.V3URL + expandRedirectPath(s.cfg.V3ProjectScreenPath, redirectPathValues{
+			Project:   prototype.GetString("project"),
+			Prototype: prototype.Id,
+			Screen:    screen.Id,
+		}), nil
+	}
+
+	return "", nil
+}
+
+// isLinkScreen checks whether the screen is accessible through the link
+// and whether it matches the optional v2 prototype path segment.
+func (s *RedirectServer) isLinkScreen(link *core.Record, screen *core.Record, params map[string]string) (bool, error) {
+	prototype, err := s.m.pbApp.FindRecordById("prototypes", screen.GetString("prototype"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil // orphaned screen
+		}
+		return false, err
+	}
+
+	if prototype.GetString("project") != link.GetString("project") {
+		return false, nil
+	}
+
+	if prototypes := link.GetStringSlice("onlyPrototypes"); len(prototypes) > 0 && !slices.Contains(prototypes, prototype.Id) {
+		return false, nil
+	}
+
+	if rawV2Id, ok := params["prototype"]; ok {
+		v2Prototype, err := s.findRecord("prototypes", "Prototype", rawV2Id)
+		if v2Prototype == nil || err != nil {
+			return false, err
+		}
+		if v2Prototype.Id != prototype.Id {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// findLink returns the v3 link of the v2 slug (or nil if missing or not migrated).
+func (s *RedirectServer) findLink(slug string) (*core.Record, error) {
+	// the v2 link id of the slug is known only from the stored link rules
+	var v2Id int
+	err := s.m.pbApp.DB().Select("v2Id").
+		From(redirectsCollectionName).
+		AndWhere(dbx.HashExp{
+			"source": s.m.idPrefix(),
+			"kind":   redirectLink,
+			"from":   expandRedirectPath(s.cfg.V2LinkPath, redirectPathValues{Slug: slug}),
+		}).
+		Limit(1).
+		Row(&v2Id)
+	if err == nil {
+		return s.findRecord("links", "ProjectLink", strconv.Itoa(v2Id))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// otherwise fallback to the source link with the same slug
+	// (the renamed duplicated slugs are resolved only with the link rules)
+	link := &core.Record{}
+	err = s.m.pbApp.RecordQuery("links").
+		AndWhere(dbx.HashExp{"username": slug}).
+		AndWhere(s.m.sourceRecordsExp()).
+		Limit(1).
+		One(link)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// findRecord returns the v3 record of the escaped v2 id (or nil if missing or not migrated).
+func (s *RedirectServer) findRecord(collection string, table string, rawV2Id string) (*core.Record, error) {
+	v2Id, err := strconv.Atoi(rawV2Id)
+	if err != nil {
+		return nil, nil // not a v2 id
+	}
+
+	id, ok := s.m.findRecordId(table, v2Id)
+	if !ok {
+		return nil, nil
+	}
+
+	record, err := s.m.pbApp.FindRecordById(collection, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// findFileURL returns the v3 url of the v2 storage file key
+// (or empty string if the file is missing or not migrated).
+func (s *RedirectServer) findFileURL(v2Key string) (string, error) {
+	row := struct {
+		Collection string `db:"v3Collection"`
+		Id         string `db:"v3Id"`
+		Field      string `db:"v3Field"`
+	}{}
+
+	err := s.m.pbApp.DB().Select("v3Collection", "v3Id", "v3Field").
+		From(fileMapCollectionName).
+		AndWhere(dbx.HashExp{"source": s.m.idPrefix(), "v2Key": v2Key}).
+		Limit(1).
+		One(&row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	record, err := s.m.pbApp.FindRecordById(row.Collection, row.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil // deleted after the migration
+		}
+		return "", err
+	}
+
+	// the file could be renamed during the copy (see [Migrator.batchCopyScreenImages])
+	filename := record.GetString(row.Field)
+	if filename == "" {
+		return "", nil
+	}
+
+	return s.cfg.V3URL + "/api/files/" +
+		url.PathEscape(record.Collection().Name) + "/" +
+		url.PathEscape(record.Id) + "/" +
+		url.PathEscape(filename), nil
+}
+
+// redirectPathRegex converts the path pattern to a regex with named groups for its placeholders.
+func redirectPathRegex(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+
+	for _, name := range []string{"slug", "project", "prototype", "screen"} {
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta("{"+name+"}"), "(?P<"+name+">[^/]+)")
+	}
+	expr = strings.ReplaceAll(expr, regexp.QuoteMeta(placeholderFile), "(?P<file>.+)")
+
+	return regexp.MustCompile("^" + expr + "/?$")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestRedirectPathRegex(t *testing.T) {
+	scenarios := []struct {
+		pattern  string
+		path     string
+		expected map[string]string // nil for no match
+	}{
+		{"/view/{slug}", "/view/abc", map[string]string{"slug": "abc"}},
+		{"/view/{slug}", "/view/abc/", map[string]string{"slug": "abc"}},
+		{"/view/{slug}", "/view/abc/1", nil},
+		{"/view/{slug}", "/view/", nil},
+		{"/view/{slug}", "/other/view/abc", nil},
+		{"/view/{slug}/{prototype}/{screen}", "/view/abc/1/2", map[string]string{"slug": "abc", "prototype": "1", "screen": "2"}},
+		{"/storage/{file}", "/storage/projects/1/a b.png", map[string]string{"file": "projects/1/a b.png"}},
+		{"/storage/{file}", "/storage/", nil},
+		{"/p.{project}", "/p.1", map[string]string{"project": "1"}},
+		{"/p.{project}", "/px1", nil},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.pattern+" "+s.path, func(t *testing.T) {
+			re := redirectPathRegex(s.pattern)
+
+			match := re.FindStringSubmatch(s.path)
+			if s.expected == nil {
+				if match != nil {
+					t.Fatalf("expected no match, got %v", match)
+				}
+				return
+			}
+
+			if match == nil {
+				t.Fatal("expected match")
+			}
+
+			for i, name := range re.SubexpNames() {
+				if name != "" && s.expected[name] != match[i] {
+					t.Errorf("expected %s %q, got %q", name, s.expected[name], match[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectServer(t *testing.T) {
+	app := newTestApp(t)
+
+	config := newTestConfig(t, app)
+	config.Redirects.V3URL = "https://v3.example.com/"
+
+	m := newTestMigrator(t, app, config)
+
+	// screen 3 of another project and screen 4 of a project prototype that is not part of the link
+	rows := []struct {
+		table  string
+		params dbx.Params
+	}{
+		{"Project", dbx.Params{"id": 2, "title": "Other", "archived": 0}},
+		{"Prototype", dbx.Params{"id": 2, "projectId": 2, "title": "Other", "type": "desktop", "width": 0, "height": 0, "scaleFactor": 1}},
+		{"Prototype", dbx.Params{"id": 3, "projectId": 1, "title": "Hidden", "type": "desktop", "width": 0, "height": 0, "scaleFactor": 1}},
+		{"Screen", dbx.Params{"id": 3, "prototypeId": 2, "order": 1, "title": "Other", "alignment": "center", "background": "#ffffff", "fixedHeader": 0, "fixedFooter": 0, "filePath": "projects/2/other.png"}},
+		{"Screen", dbx.Params{"id": 4, "prototypeId": 3, "order": 1, "title": "Hidden", "alignment": "center", "background": "#ffffff", "fixedHeader": 0, "fixedFooter": 0, "filePath": "projects/1/hidden.png"}},
+	}
+	for _, row := range rows {
+		if _, err := m.oldDB.Insert(row.table, row.params).Execute(); err != nil {
+			t.Fatalf("failed to insert %s row: %v", row.table, err)
+		}
+	}
+
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewRedirectServer(app, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "/view/abc123", http.StatusMovedPermanently, "https://v3.example.com/#/abc123"},
+		{http.MethodHead, "/view/abc123/", http.StatusMovedPermanently, "https://v3.example.com/#/abc123"},
+		{http.MethodGet, "/view/abc123/1/2", http.StatusMovedPermanently, "https://v3.example.com/#/abc123/pr2_1/pr2_2"},
+		{http.MethodGet, "/storage/projects/1/screen1.png", http.StatusMovedPermanently, "https://v3.example.com/api/files/screens/pr2_1/screen1.png"},
+		{http.MethodGet, "/storage/users/1/avatar.png", http.StatusMovedPermanently, "https://v3.example.com/api/files/users/pr2_1/avatar.png"},
+		{http.MethodGet, "/projects/1", http.StatusMovedPermanently, "https://v3.example.com/#/projects/pr2_1"},
+		{http.MethodGet, "/projects/1/prototypes/1", http.StatusMovedPermanently, "https://v3.example.com/#/projects/pr2_1/prototypes/pr2_1"},
+		{http.MethodGet, "/projects/1/prototypes/1/screens/2", http.StatusMovedPermanently, "https://v3.example.com/#/projects/pr2_1/prototypes/pr2_1/screens/pr2_2"},
+		{http.MethodGet, "/view/missing", http.StatusNotFound, ""},
+		{http.MethodGet, "/view/abc123/1/999", http.StatusNotFound, ""},
+		{http.MethodGet, "/view/abc123/2/3", http.StatusNotFound, ""},
+		{http.MethodGet, "/view/abc123/3/4", http.StatusNotFound, ""},
+		{http.MethodGet, "/view/abc123/3/2", http.StatusNotFound, ""},
+		{http.MethodGet, "/view/abc123/999/2", http.StatusNotFound, ""},
+		{http.MethodGet, "/storage/projects/1/missing.png", http.StatusNotFound, ""},
+		{http.MethodGet, "/projects/abc", http.StatusNotFound, ""},
+		{http.MethodPost, "/view/abc123", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.method+" "+s.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			server.ServeHTTP(rec, httptest.NewRequest(s.method, s.path, nil))
+
+			if rec.Code != s.status {
+				t.Fatalf("expected status %d, got %d", s.status, rec.Code)
+			}
+
+			if location := rec.Header().Get("Location"); location != s.location {
+				t.Fatalf("expected location %q, got %q", s.location, location)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const redirectsCollectionName = "_migrationRedirects"
+
+// Redirect rule kinds.
+const (
+	redirectLink   = "link"
+	redirectScreen = "screen"
+)
+
+// Redirect path placeholders.
+const (
+	placeholderSlug      = "{slug}"
+	placeholderProject   = "{project}"
+	placeholderPrototype = "{prototype}"
+	placeholderScreen    = "{screen}"
+	placeholderFile      = "{file}"
+)
+
+// RedirectsConfig defines the legacy v2 share urls redirect settings
+// (see [Migrator.GenerateRedirects]).
+//
+// The path patterns could contain the {slug}, {project}, {prototype}, {screen} and {file} placeholders
+// (the v2 values for the v2 paths and the v3 values for the v3 paths).
+type RedirectsConfig struct {
+	// V3URL is the public v3 url (default to the pb_data Application URL setting).
+	V3URL string `json:"v3Url,omitempty"`
+
+	// V2LinkPath is the v2 share link path (default to "/view/{slug}").
+	V2LinkPath string `json:"v2LinkPath,omitempty"`
+
+	// V2ScreenPath is the v2 screen deep link path (default to "/view/{slug}/{prototype}/{screen}").
+	V2ScreenPath string `json:"v2ScreenPath,omitempty"`
+
+	// V3LinkPath is the v3 link path (default to "/#/{slug}").
+	V3LinkPath string `json:"v3LinkPath,omitempty"`
+
+	// V3ScreenPath is the v3 screen path (default to "/#/{slug}/{prototype}/{screen}").
+	V3ScreenPath string `json:"v3ScreenPath,omitempty"`
+
+	// The v2 storage file path and the v2 and v3 app project, prototype and screen paths
+	// (used only by the redirect server):
+	//   - v2FilePath          (default to "/storage/{file}")
+	//   - v2ProjectPath       (default to "/projects/{project}")
+	//   - v2PrototypePath     (default to "/projects/{project}/prototypes/{prototype}")
+	//   - v2ProjectScreenPath (default to "/projects/{project}/prototypes/{prototype}/screens/{screen}")
+	//   - v3ProjectPath       (default to "/#/projects/{project}")
+	//   - v3PrototypePath     (default to "/#/projects/{project}/prototypes/{prototype}")
+	//   - v3ProjectScreenPath (default to "/#/projects/{project}/prototypes/{prototype}/screens/{screen}")
+	V2FilePath          string `json:"v2FilePath,omitempty"`
+	V2ProjectPath       string `json:"v2ProjectPath,omitempty"`
+	V2PrototypePath     string `json:"v2PrototypePath,omitempty"`
+	V2ProjectScreenPath string `json:"v2ProjectScreenPath,omitempty"`
+	V3ProjectPath       string `json:"v3ProjectPath,omitempty"`
+	V3PrototypePath     string `json:"v3PrototypePath,omitempty"`
+	V3ProjectScreenPath string `json:"v3ProjectScreenPath,omitempty"`
+}
+
+// withDefaults returns a copy of the config with the default path patterns.
+func (c RedirectsConfig) withDefaults() RedirectsConfig {
+	if c.V2LinkPath == "" {
+		c.V2LinkPath = "/view/{slug}"
+	}
+	if c.V2ScreenPath == "" {
+		c.V2ScreenPath = "/view/{slug}/{prototype}/{screen}"
+	}
+	if c.V3LinkPath == "" {
+		c.V3LinkPath = "/#/{slug}"
+	}
+	if c.V3ScreenPath == "" {
+		c.V3ScreenPath = "/#/{slug}/{prototype}/{screen}"
+	}
+	if c.V2FilePath == "" {
+		c.V2FilePath = "/storage/{file}"
+	}
+	if c.V2ProjectPath == "" {
+		c.V2ProjectPath = "/projects/{project}"
+	}
+	if c.V2PrototypePath == "" {
+		c.V2PrototypePath = "/projects/{project}/prototypes/{prototype}"
+	}
+	if c.V2ProjectScreenPath == "" {
+		c.V2ProjectScreenPath = "/projects/{project}/prototypes/{prototype}/screens/{screen}"
+	}
+	if c.V3ProjectPath == "" {
+		c.V3ProjectPath = "/#/projects/{project}"
+	}
+	if c.V3PrototypePath == "" {
+		c.V3PrototypePath = "/#/projects/{project}/prototypes/{prototype}"
+	}
+	if c.V3ProjectScreenPath == "" {
+		c.V3ProjectScreenPath = "/#/projects/{project}/prototypes/{prototype}/screens/{screen}"
+	}
+
+	return c
+}
+
+// Validate checks whether the redirect path patterns have the required placeholders.
+func (c RedirectsConfig) Validate() error {
+	c = c.withDefaults()
+
+	if c.V3URL != "" {
+		if u, err := url.Parse(c.V3URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("redirects.v3Url must be an absolute url")
+		}
+	}
+
+	for _, p := range []struct {
+		name         string
+		pattern      string
+		placeholders []string
+	}{
+		{"v2LinkPath", c.V2LinkPath, []string{placeholderSlug}},
+		{"v2ScreenPath", c.V2ScreenPath, []string{placeholderSlug, placeholderScreen}},
+		{"v3LinkPath", c.V3LinkPath, []string{placeholderSlug}},
+		{"v3ScreenPath", c.V3ScreenPath, []string{placeholderSlug, placeholderScreen}},
+		{"v2FilePath", c.V2FilePath, []string{placeholderFile}},
+		{"v2ProjectPath", c.V2ProjectPath, []string{placeholderProject}},
+		{"v2PrototypePath", c.V2PrototypePath, []string{placeholderPrototype}},
+		{"v2ProjectScreenPath", c.V2ProjectScreenPath, []string{placeholderScreen}},
+		{"v3ProjectPath", c.V3ProjectPath, []string{placeholderProject}},
+		{"v3PrototypePath", c.V3PrototypePath, []string{placeholderPrototype}},
+		{"v3ProjectScreenPath", c.V3ProjectScreenPath, []string{placeholderScreen}},
+	} {
+		if !strings.HasPrefix(p.pattern, "/") {
+			return fmt.Errorf("redirects.%s must start with /", p.name)
+		}
+
+		for _, placeholder := range p.placeholders {
+			if !strings.Contains(p.pattern, placeholder) {
+				return fmt.Errorf("redirects.%s must contain the %s placeholder", p.name, placeholder)
+			}
+		}
+	}
+
+	return nil
+}
+
+// redirectPathValues holds the path pattern placeholder values.
+type redirectPathValues struct {
+	Slug      string
+	Project   string
+	Prototype string
+	Screen    string
+}
+
+// expandRedirectPath replaces the path pattern placeholders with their url escaped values.
+func expandRedirectPath(pattern string, values redirectPathValues) string {
+	return strings.NewReplacer(
+		placeholderSlug, url.PathEscape(values.Slug),
+		placeholderProject, url.PathEscape(values.Project),
+		placeholderPrototype, url.PathEscape(values.Prototype),
+		placeholderScreen, url.PathEscape(values.Screen),
+	).Replace(pattern)
+}
+
+// redirectRule is a single v2 to v3 url redirect.
+type redirectRule struct {
+	Kind string
+	V2Id int
+	From string
+	To   string
+}
+
+// GenerateRedirects builds the redirect rules from the v2 share urls
+// to the matching migrated v3 links and screens and writes them in outDir
+// as nginx, Caddy and Apache rewrite configs and as a CSV file.
+//
+// The rules are also stored in the pb_data [redirectsCollectionName] collection.
+func (m *Migrator) GenerateRedirects(outDir string) error {
+	start := time.Now()
+
+	cfg := m.config.Redirects.withDefaults()
+	if cfg.V3URL == "" {
+		cfg.V3URL = m.pbApp.Settings().Meta.AppURL
+	}
+	if cfg.V3URL == "" {
+		return errors.New("redirects.v3Url is not set and the pb_data Application URL setting is empty")
+	}
+	cfg.V3URL = strings.TrimRight(cfg.V3URL, "/")
+
+	if err := m.loadIdMap(); err != nil {
+		return err
+	}
+
+	m.logger.Info("Generating v2 share urls redirects...", "v3Url", cfg.V3URL)
+
+	rules, err := m.buildRedirectRules(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	writers := []struct {
+		file  string
+		write func(f *os.File, rules []*redirectRule) error
+	}{
+		{"redirects.nginx.conf", writeNginxRedirects},
+		{"redirects.caddy", writeCaddyRedirects},
+		{"redirects.apache.conf", writeApacheRedirects},
+		{"redirects.csv", writeCSVRedirects},
+	}
+
+	for _, w := range writers {
+		if err := writeRedirectsFile(filepath.Join(outDir, w.file), rules, w.write); err != nil {
+			return fmt.Errorf("failed to write %s: %w", w.file, err)
+		}
+	}
+
+	if err := m.saveRedirects(rules); err != nil {
+		return fmt.Errorf("failed to store the redirects: %w", err)
+	}
+
+	m.logger.Info("Redirects generated successfully.", "rules", len(rules), "out", outDir, "elapsed", time.Since(start).String())
+
+	return nil
+}
+
+// buildRedirectRules returns the redirect rules of all migrated v2 project links.
+func (m *Migrator) buildRedirectRules(cfg RedirectsConfig) ([]*redirectRule, error) {
+	linksCollection, err := m.pbApp.FindCollectionByNameOrId("links")
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*redirectRule
+
+	limit := 1000
+	items := make([]*v2ProjectLink, 0, limit)
+	for i := 0; ; i++ {
+		q := m.oldDB.Select("*").
+			From("ProjectLink").
+			OrderBy("id asc").
+			Limit(int64(limit)).
+			Offset(int64(i * limit))
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			linkId, ok := m.findRecordId("ProjectLink", item.Id)
+			if !ok {
+				m.logger.Warn("Skipped redirects of a not migrated link", "step", "redirects", "v2Id", item.Id, "slug", item.Slug)
+				continue
+			}
+
+			link, err := m.pbApp.FindRecordById(linksCollection, linkId)
+			if err != nil {
+				m.logger.Warn("Skipped redirects of a not migrated link", "step", "redirects", "v2Id", item.Id, "slug", item.Slug)
+				continue
+			}
+
+			// the v3 slug could be different (see MigrateLinks)
+			slug := link.GetString("username")
+
+			rules = append(rules, &redirectRule{
+				Kind: redirectLink,
+				V2Id: item.Id,
+				From: expandRedirectPath(cfg.V2LinkPath, redirectPathValues{Slug: item.Slug}),
+				To:   cfg.V3URL + expandRedirectPath(cfg.V3LinkPath, redirectPathValues{Slug: slug}),
+			})
+
+			screens, err := m.linkRedirectScreens(item)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, screen := range screens {
+				prototypeId, ok := m.findRecordId("Prototype", screen.PrototypeId)
+				if !ok {
+					continue // not migrated
+				}
+
+				screenId, ok := m.findRecordId("Screen", screen.Id)
+				if !ok {
+					continue // not migrated
+				}
+
+				rules = append(rules, &redirectRule{
+					Kind: redirectScreen,
+					V2Id: screen.Id,
+					From: expandRedirectPath(cfg.V2ScreenPath, redirectPathValues{
+						Slug:      item.Slug,
+						Prototype: strconv.Itoa(screen.PrototypeId),
+						Screen:    strconv.Itoa(screen.Id),
+					}),
+					To: cfg.V3URL + expandRedirectPath(cfg.V3ScreenPath, redirectPathValues{
+						Slug:      slug,
+						Prototype: prototypeId,
+						Screen:    screenId,
+					}),
+				})
+			}
+		}
+
+		if len(items) < limit {
+			break // no more items
+		}
+	}
+
+	return rules, nil
+}
+
+// linkRedirectScreens returns the v2 screens accessible through the project link
+// (either from the link prototypes or from all project prototypes if the link has no prototypes).
+//
+// A link whose prototype rel rows are all dangling has no accessible screens.
+func (m *Migrator) linkRedirectScreens(link *v2ProjectLink) ([]*v2Screen, error) {
+	var screens []*v2Screen
+
+	err := m.retry("v2 relation query", func() error {
+		screens = nil
+
+		var totalRels int
+		err := m.oldDB.Select("count(*)").
+			From("ProjectLinkPrototypeRel").
+			AndWhere(dbx.HashExp{"projectLinkId": link.Id}).
+			Row(&totalRels)
+		if err != nil {
+			return err
+		}
+
+		q := m.oldDB.Select("Screen.id", "Screen.prototypeId").
+			Distinct(true).
+			From("Screen").
+			InnerJoin("Prototype", dbx.NewExp("[[Prototype.id]] = [[Screen.prototypeId]]")).
+			AndWhere(dbx.HashExp{"Prototype.projectId": link.ProjectId}).
+			OrderBy("Screen.id asc")
+		if totalRels > 0 {
+			q.InnerJoin("ProjectLinkPrototypeRel", dbx.NewExp(
+				"[[ProjectLinkPrototypeRel.prototypeId]] = [[Prototype.id]] AND [[ProjectLinkPrototypeRel.projectLinkId]] = {:linkId}",
+				dbx.Params{"linkId": link.Id},
+			))
+		}
+
+		return q.All(&screens)
+	})
+
+	return screens, err
+}
+
+// saveRedirects replaces the stored redirects of the current source with the provided ones.
+func (m *Migrator) saveRedirects(rules []*redirectRule) error {
+	if err := m.ensureRedirectsCollection(); err != nil {
+		return err
+	}
+
+	return m.pbApp.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().Delete(redirectsCollectionName, dbx.HashExp{"source": m.idPrefix()}).Execute()
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range rules {
+			_, err := txApp.DB().Insert(redirectsCollectionName, dbx.Params{
+				"id":     core.GenerateDefaultRandomId(),
+				"source": m.idPrefix(),
+				"kind":   rule.Kind,
+				"v2Id":   rule.V2Id,
+				"from":   rule.From,
+				"to":     rule.To,
+			}).Execute()
+			if err != nil {
+				return fmt.Errorf("failed to insert redirect %q: %w", rule.From, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) ensureRedirectsCollection() error {
+	collection, _ := m.pbApp.FindCollectionByNameOrId(redirectsCollectionName)
+	if collection != nil {
+		return nil
+	}
+
+	collection = core.NewBaseCollection(redirectsCollectionName)
+	collection.System = true
+	collection.Fields.Add(
+		&core.TextField{Name: "source"},
+		&core.SelectField{
+			Name:      "kind",
+			Values:    []string{redirectLink, redirectScreen},
+			MaxSelect: 1,
+		},
+		&core.NumberField{Name: "v2Id", OnlyInt: true},
+		&core.TextField{Name: "from"},
+		&core.TextField{Name: "to"},
+	)
+	collection.AddIndex("idx_migrationRedirects_from", false, "`from`", "")
+
+	return m.pbApp.Save(collection)
+}
+
+func writeRedirectsFile(path string, rules []*redirectRule, write func(f *os.File, rules []*redirectRule) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f, rules); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+const redirectsHeader = "Presentator v2 to v3 redirects (generated by v2tov3migrate)"
+
+// writeNginxRedirects writes the rules as nginx exact match locations
+// (the file is expected to be included in a server block).
+func writeNginxRedirects(f *os.File, rules []*redirectRule) error {
+	if _, err := fmt.Fprintf(f, "# %s\n", redirectsHeader); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		_, err := fmt.Fprintf(f, "location = %s { return 301 %s; }\n", quoteConf(rule.From), quoteConf(rule.To))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quoteConf wraps the value in double quotes
+// (the paths are url escaped so they can't contain quotes).
+func quoteConf(s string) string {
+	return `"` + s + `"`
+}
+
+// writeCaddyRedirects writes the rules as Caddy redir directives
+// (the file is expected to be imported in a site block).
+func writeCaddyRedirects(f *os.File, rules []*redirectRule) error {
+	if _, err := fmt.Fprintf(f, "# %s\n", redirectsHeader); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		_, err := fmt.Fprintf(f, "redir %s %s permanent\n", quoteConf(rule.From), quoteConf(rule.To))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeApacheRedirects writes the rules as mod_rewrite rules
+// (the file is expected to be included in a VirtualHost).
+//
+// The NE flag keeps the "#" of the v3 hash urls unescaped.
+func writeApacheRedirects(f *os.File, rules []*redirectRule) error {
+	if _, err := fmt.Fprintf(f, "# %s\nRewriteEngine On\n", redirectsHeader); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		_, err := fmt.Fprintf(f, "RewriteRule %s %s [R=301,L,NE]\n", quoteConf("^"+regexp.QuoteMeta(rule.From)+"/?$"), quoteConf(rule.To))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSVRedirects(f *os.File, rules []*redirectRule) error {
+	w := csv.NewWriter(f)
+
+	if err := w.Write([]string{"kind", "v2Id", "from", "to"}); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := w.Write([]string{rule.Kind, strconv.Itoa(rule.V2Id), rule.From, rule.To}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestGenerateRedirectsIdMapping(t *testing.T) {
+	app := newTestApp(t)
+
+	config := newTestConfig(t, app)
+	config.OpaqueIds = true
+	config.Redirects.V3URL = "https://v3.example.com"
+
+	m := newTestMigrator(t, app, config)
+
+	// nothing is migrated yet
+	if err := m.GenerateRedirects(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	total, err := app.CountRecords(idMapCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 {
+		t.Fatalf("expected no generated id mappings, got %d", total)
+	}
+
+	rules, err := app.CountRecords(redirectsCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules != 0 {
+		t.Fatalf("expected no redirect rules, got %d", rules)
+	}
+
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := app.CountRecords(idMapCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.GenerateRedirects(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	total, err = app.CountRecords(idMapCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != migrated {
+		t.Fatalf("expected %d id mappings, got %d", migrated, total)
+	}
+
+	rules, err = app.CountRecords(redirectsCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules == 0 {
+		t.Fatal("expected the redirect rules of the migrated link")
+	}
+}
+
+func TestLinkRedirectScreens(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestMigrator(t, app, newTestConfig(t, app))
+
+	// link 2 has no prototypes, link 3 has only a deleted prototype
+	// and link 4 has both a deleted and an existing prototype
+	for _, rel := range []dbx.Params{
+		{"id": 2, "projectLinkId": 3, "prototypeId": 99},
+		{"id": 3, "projectLinkId": 4, "prototypeId": 99},
+		{"id": 4, "projectLinkId": 4, "prototypeId": 1},
+	} {
+		if _, err := m.oldDB.Insert("ProjectLinkPrototypeRel", rel).Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scenarios := []struct {
+		name     string
+		link     *v2ProjectLink
+		expected []int
+	}{
+		{"link prototypes", &v2ProjectLink{baseModel: baseModel{Id: 1}, ProjectId: 1}, []int{1, 2}},
+		{"no link prototypes", &v2ProjectLink{baseModel: baseModel{Id: 2}, ProjectId: 1}, []int{1, 2}},
+		{"only dangling link prototypes", &v2ProjectLink{baseModel: baseModel{Id: 3}, ProjectId: 1}, nil},
+		{"partially dangling link prototypes", &v2ProjectLink{baseModel: baseModel{Id: 4}, ProjectId: 1}, []int{1, 2}},
+		{"another project", &v2ProjectLink{baseModel: baseModel{Id: 2}, ProjectId: 99}, nil},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			screens, err := m.linkRedirectScreens(s.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int
+			for _, screen := range screens {
+				ids = append(ids, screen.Id)
+			}
+
+			if !slices.Equal(ids, s.expected) {
+				t.Fatalf("expected screens %v, got %v", s.expected, ids)
+			}
+		})
+	}
+}
+
+func TestExpandRedirectPath(t *testing.T) {
+	result := expandRedirectPath("/{slug}/{project}/{prototype}/{screen}", redirectPathValues{
+		Slug:      "a b",
+		Project:   "p/1",
+		Prototype: "?2",
+		Screen:    "#3",
+	})
+
+	expected := "/a%20b/p%2F1/%3F2/%233"
+	if result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gocloud.dev/gcerrors"
+)
+
+// RetryConfig defines the retry limits for the transient v2 DB and storage failures.
+//
+// The durations are in Go format (eg. "500ms", "10s").
+type RetryConfig struct {
+	// MaxAttempts is the max number of attempts per operation (default to 3).
+	//
+	// Set it to 1 to disable the retries.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// InitialDelay is the delay before the first retry (default to "500ms").
+	//
+	// Each following retry doubles the previous delay.
+	InitialDelay string `json:"initialDelay,omitempty"`
+
+	// MaxDelay is the max delay between two attempts (default to "10s").
+	MaxDelay string `json:"maxDelay,omitempty"`
+}
+
+// Validate checks whether the retry config values are valid.
+func (c RetryConfig) Validate() error {
+	if c.MaxAttempts < 0 {
+		return errors.New("retry.maxAttempts must be non-negative")
+	}
+
+	if _, err := parseOptionalDuration(c.InitialDelay); err != nil {
+		return fmt.Errorf("invalid retry.initialDelay: %w", err)
+	}
+
+	if _, err := parseOptionalDuration(c.MaxDelay); err != nil {
+		return fmt.Errorf("invalid retry.maxDelay: %w", err)
+	}
+
+	return nil
+}
+
+// policy returns a new [retryPolicy] initialized from the config values.
+func (c RetryConfig) policy() retryPolicy {
+	p := retryPolicy{
+		maxAttempts:  3,
+		initialDelay: 500 * time.Millisecond,
+		maxDelay:     10 * time.Second,
+	}
+
+	if c.MaxAttempts > 0 {
+		p.maxAttempts = c.MaxAttempts
+	}
+
+	if d, _ := parseOptionalDuration(c.InitialDelay); d > 0 {
+		p.initialDelay = d
+	}
+
+	if d, _ := parseOptionalDuration(c.MaxDelay); d > 0 {
+		p.maxDelay = d
+	}
+
+	return p
+}
+
+// retryPolicy retries failed operations with exponential backoff and equal jitter.
+type retryPolicy struct {
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+// delay returns the randomized wait duration before the specified retry attempt (starting from 1).
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.initialDelay << (attempt - 1)
+	if d <= 0 || d > p.maxDelay {
+		d = p.maxDelay
+	}
+
+	// equal jitter in the [d/2, d] range
+	return d/2 + rand.N(d/2+1)
+}
+
+// isRetryable reports whether err is a transient failure
+// (network errors, timeouts, broken DB connections and the 5xx or 429 storage responses).
+//
+// All other errors (eg. missing rows or files, invalid queries, denied access)
+// are returned immediately since retrying them will fail the same way.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		pgconn.SafeToRetry(err) ||
+		pgconn.Timeout(err) {
+		return true
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.DeadlineExceeded, gcerrors.ResourceExhausted:
+		return true
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		code := statusErr.HTTPStatusCode()
+		return code >= 500 || code == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retry executes fn until it succeeds or the retry policy limits are reached.
+//
+// fn must be safe to call multiple times (eg. reset any appended query results).
+func (m *Migrator) retry(op string, fn func() error) error {
+	policy := m.config.Retry.policy()
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) || attempt >= policy.maxAttempts {
+			return err
+		}
+
+		delay := policy.delay(attempt)
+
+		m.logger.Debug("Retrying failed operation", "op", op, "attempt", attempt, "delay", delay.String(), "error", err)
+
+		time.Sleep(delay)
+	}
+}
+
+// -------------------------------------------------------------------
+
+// failedFile holds a single file that couldn't be copied.
+type failedFile struct {
+	Step   string
+	OldKey string
+	NewKey string
+}
+
+// failedFiles is a concurrent safe queue of the files
+// that should be retried at the end of the migration.
+type failedFiles struct {
+	mu    sync.Mutex
+	files []failedFile
+}
+
+func (q *failedFiles) add(f failedFile) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.files = append(q.files, f)
+}
+
+// drain returns and clears all queued files.
+func (q *failedFiles) drain() []failedFile {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	files := q.files
+	q.files = nil
+
+	return files
+}
+
+// RetryFailedFiles retries once more copying all files that
+// failed during the previous migration steps.
+func (m *Migrator) RetryFailedFiles() error {
+	files := m.failedFiles.drain()
+	if len(files) == 0 {
+		return m.checkFileErrorRate(true)
+	}
+
+	var recovered int
+
+	for _, f := range files {
+		if err := m.copyFile(f.OldKey, f.NewKey); err != nil {
+			if err := m.handleFileCopyError(f, err, true); err != nil {
+				return err
+			}
+			continue
+		}
+
+		recovered++
+		m.fileStats.addCopied(true)
+	}
+
+	m.logger.Info("Retried failed files", "total", len(files), "recovered", recovered, "failed", len(files)-recovered)
+
+	return m.checkFileErrorRate(true)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+func TestIsRetryable(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"filesystem not found", filesystem.ErrNotFound, false},
+		{"fs not exist", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}, false},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), false},
+		{"syntax error", &mysql.MySQLError{Number: 1064, Message: "syntax error"}, false},
+		{"generic", errors.New("invalid data"), false},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{"bad conn", fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{"mysql invalid conn", mysql.ErrInvalidConn, true},
+		{"net error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"http 404", &httpStatusError{Status: "404 Not Found", Code: http.StatusNotFound}, false},
+		{"http 403", &httpStatusError{Status: "403 Forbidden", Code: http.StatusForbidden}, false},
+		{"http 429", &httpStatusError{Status: "429 Too Many Requests", Code: http.StatusTooManyRequests}, true},
+		{"http 500", fmt.Errorf("get: %w", &httpStatusError{Status: "500 Internal Server Error", Code: http.StatusInternalServerError}), true},
+		{"http 503", &httpStatusError{Status: "503 Service Unavailable", Code: http.StatusServiceUnavailable}, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := isRetryable(s.err); result != s.expected {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"success", nil, 1},
+		{"permanent error", sql.ErrNoRows, 1},
+		{"transient error", driver.ErrBadConn, 3},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			m := &Migrator{
+				config: &Config{Retry: RetryConfig{MaxAttempts: 3, InitialDelay: "1ms", MaxDelay: "1ms"}},
+				logger: slog.Default(),
+			}
+
+			var attempts int
+			err := m.retry("test", func() error {
+				attempts++
+				return s.err
+			})
+
+			if !errors.Is(err, s.err) {
+				t.Fatalf("expected error %v, got %v", s.err, err)
+			}
+
+			if attempts != s.expected {
+				t.Fatalf("expected %d attempts, got %d", s.expected, attempts)
+			}
+		})
+	}
+}
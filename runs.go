@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	runsCollectionName   = "_migrationRuns"
+	issuesCollectionName = "_migrationIssues"
+)
+
+const (
+	runStatusRunning     = "running"
+	runStatusSuccess     = "success"
+	runStatusFailed      = "failed"
+	runStatusInterrupted = "interrupted"
+)
+
+// issueAttrs lists the log attributes that are stored as separate issue fields.
+var issueAttrs = []string{"step", "v2Id", "v3Id", "fileKey"}
+
+// stepStats holds the summary of a single migration step.
+type stepStats struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Rows     int64  `json:"rows"`
+	Bytes    int64  `json:"bytes"`
+	Warnings int    `json:"warnings"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// migrationIssue holds a single logged migration warning or error.
+type migrationIssue struct {
+	Level   string
+	Message string
+	Attrs   map[string]any
+}
+
+// migrationRun holds the state of a single [Migrator.MigrateAll] run
+// that is persisted in the [runsCollectionName] pb_data collection.
+//
+// The run issues are queued and saved in the background by [Migrator.writeRunIssues]
+// because they could be logged while a pb_data transaction is in progress.
+type migrationRun struct {
+	mu     sync.Mutex
+	record *core.Record
+	steps  []*stepStats
+	queue  []*migrationIssue
+	closed bool
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// addIssue queues a new run issue for saving.
+func (r *migrationRun) addIssue(issue *migrationIssue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return // logged after the run has finished
+	}
+
+	r.queue = append(r.queue, issue)
+
+	if step, ok := issue.Attrs["step"].(string); ok {
+		for _, s := range r.steps {
+			if s.Name == step {
+				s.Warnings++
+			}
+		}
+	}
+
+	select {
+	case r.notify <- struct{}{}:
+	default: // the writer is already notified
+	}
+}
+
+// drain returns and clears the queued issues.
+func (r *migrationRun) drain() []*migrationIssue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	issues := r.queue
+	r.queue = nil
+
+	return issues
+}
+
+// close stops accepting new issues and waits for the queued ones to be saved.
+func (r *migrationRun) close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.notify)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+// stepsSnapshot returns a copy of the current steps stats.
+func (r *migrationRun) stepsSnapshot() []stepStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps := make([]stepStats, len(r.steps))
+	for i, s := range r.steps {
+		steps[i] = *s
+	}
+
+	return steps
+}
+
+// startRun creates a new migration run record
+// (the runs left as running by a killed process are marked as interrupted).
+func (m *Migrator) startRun() error {
+	if err := m.ensureRunsCollections(); err != nil {
+		return fmt.Errorf("failed to create the migration runs collections: %w", err)
+	}
+
+	collection, err := m.pbApp.FindCollectionByNameOrId(runsCollectionName)
+	if err != nil {
+		return err
+	}
+
+	interrupted, err := m.pbApp.FindAllRecords(collection, dbx.HashExp{"status": runStatusRunning})
+	if err != nil {
+		return fmt.Errorf("failed to fetch the interrupted migration runs: %w", err)
+	}
+	for _, r := range interrupted {
+		r.Set("status", runStatusInterrupted)
+		if err := m.pbApp.Save(r); err != nil {
+			return fmt.Errorf("failed to mark the interrupted migration run %q: %w", r.Id, err)
+		}
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("started", types.NowDateTime())
+	record.Set("status", runStatusRunning)
+	record.Set("configHash", m.config.Hash())
+
+	if err := m.pbApp.Save(record); err != nil {
+		return fmt.Errorf("failed to save the migration run: %w", err)
+	}
+
+	run := &migrationRun{
+		record: record,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	go m.writeRunIssues(run)
+
+	m.run.Store(run)
+
+	return nil
+}
+
+// runStep executes a single migration step and tracks its stats in the current run.
+func (m *Migrator) runStep(name string, title string, fn func() error) error {
+	run := m.run.Load()
+
+	stats := &stepStats{Name: name, Status: runStatusRunning}
+	if run != nil {
+		run.mu.Lock()
+		run.steps = append(run.steps, stats)
+		run.mu.Unlock()
+
+		m.saveRunSteps(run)
+	}
+
+	m.logger.Info("Migrating "+title+"...", "step", name)
+
+	start := time.Now()
+
+	err := fn()
+
+	if run != nil {
+		run.mu.Lock()
+	}
+
+	stats.Duration = time.Since(start).Round(time.Millisecond).String()
+	if m.progress != nil && m.progress.step == name {
+		stats.Rows = m.progress.rows.Load()
+		stats.Bytes = m.progress.bytes.Load()
+	}
+
+	if err != nil {
+		stats.Status = runStatusFailed
+		stats.Error = err.Error()
+	} else {
+		stats.Status = runStatusSuccess
+	}
+
+	if run != nil {
+		run.mu.Unlock()
+
+		m.saveRunSteps(run)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", title, err)
+	}
+
+	return nil
+}
+
+// saveRunSteps saves the current steps stats of the run.
+func (m *Migrator) saveRunSteps(run *migrationRun) {
+	run.record.Set("steps", run.stepsSnapshot())
+
+	if err := m.pbApp.Save(run.record); err != nil {
+		// log with the base handler to avoid registering it as a run issue
+		slog.Default().Error("Failed to save the migration run steps", "error", err)
+	}
+}
+
+// finishRun waits for the queued run issues to be saved
+// and updates the current run record with the final run status.
+func (m *Migrator) finishRun(runErr error) {
+	run := m.run.Swap(nil)
+	if run == nil {
+		return
+	}
+
+	run.close()
+
+	status := runStatusSuccess
+	if runErr != nil {
+		status = runStatusFailed
+		run.record.Set("error", runErr.Error())
+	}
+	run.record.Set("status", status)
+	run.record.Set("finished", types.NowDateTime())
+	run.record.Set("steps", run.stepsSnapshot())
+
+	if err := m.pbApp.Save(run.record); err != nil {
+		// log with the base handler to avoid registering it as a run issue
+		slog.Default().Error("Failed to save the migration run", "error", err)
+	}
+}
+
+// writeRunIssues saves the queued run issues as they are logged
+// until the run is closed (see [migrationRun.close]).
+func (m *Migrator) writeRunIssues(run *migrationRun) {
+	defer close(run.done)
+
+	for range run.notify {
+		m.saveRunIssues(run, run.drain())
+	}
+
+	// the issues queued right before the close
+	m.saveRunIssues(run, run.drain())
+}
+
+// saveRunIssues saves the provided run issues in a single transaction.
+func (m *Migrator) saveRunIssues(run *migrationRun, issues []*migrationIssue) {
+	if len(issues) == 0 {
+		return
+	}
+
+	err := m.pbApp.RunInTransaction(func(txApp core.App) error {
+		issuesCollection, err := txApp.FindCollectionByNameOrId(issuesCollectionName)
+		if err != nil {
+			return err
+		}
+
+		for _, issue := range issues {
+			r := core.NewRecord(issuesCollection)
+			r.Set("run", run.record.Id)
+			r.Set("level", issue.Level)
+			r.Set("message", issue.Message)
+
+			details := map[string]any{}
+			for k, v := range issue.Attrs {
+				if slices.Contains(issueAttrs, k) {
+					r.Set(k, fmt.Sprint(v))
+				} else {
+					details[k] = v
+				}
+			}
+			r.Set("details", details)
+
+			if err := txApp.Save(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		// log with the base handler to avoid registering it as a run issue
+		slog.Default().Error("Failed to save the migration run issues", "issues", len(issues), "error", err)
+	}
+}
+
+// ensureRunsCollections creates the migration runs and issues
+// collections if they don't exist
+// (the missing status values of an existing runs collection are also added).
+//
+// Both collections are accessible only by superusers and could be
+// reviewed from the PocketBase Dashboard.
+func (m *Migrator) ensureRunsCollections() error {
+	statuses := []string{runStatusRunning, runStatusSuccess, runStatusFailed, runStatusInterrupted}
+
+	runs, _ := m.pbApp.FindCollectionByNameOrId(runsCollectionName)
+	if runs == nil {
+		runs = core.NewBaseCollection(runsCollectionName)
+		runs.System = true
+		runs.Fields.Add(
+			&core.DateField{Name: "started"},
+			&core.DateField{Name: "finished"},
+			&core.SelectField{
+				Name:      "status",
+				Values:    statuses,
+				MaxSelect: 1,
+			},
+			&core.TextField{Name: "configHash"},
+			&core.JSONField{Name: "steps"},
+			&core.TextField{Name: "error"},
+		)
+		if err := m.pbApp.Save(runs); err != nil {
+			return err
+		}
+	} else if status, ok := runs.Fields.GetByName("status").(*core.SelectField); ok {
+		var changed bool
+		for _, v := range statuses {
+			if !slices.Contains(status.Values, v) {
+				status.Values = append(status.Values, v)
+				changed = true
+			}
+		}
+		if changed {
+			if err := m.pbApp.Save(runs); err != nil {
+				return err
+			}
+		}
+	}
+
+	issues, _ := m.pbApp.FindCollectionByNameOrId(issuesCollectionName)
+	if issues == nil {
+		issues = core.NewBaseCollection(issuesCollectionName)
+		issues.System = true
+		issues.Fields.Add(
+			&core.RelationField{
+				Name:          "run",
+				CollectionId:  runs.Id,
+				MaxSelect:     1,
+				CascadeDelete: true,
+			},
+			&core.SelectField{
+				Name:      "level",
+				Values:    []string{slog.LevelWarn.String(), slog.LevelError.String()},
+				MaxSelect: 1,
+			},
+			&core.TextField{Name: "message"},
+			&core.TextField{Name: "step"},
+			&core.TextField{Name: "v2Id"},
+			&core.TextField{Name: "v3Id"},
+			&core.TextField{Name: "fileKey"},
+			&core.JSONField{Name: "details"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		if err := m.pbApp.Save(issues); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------------------
+
+var _ slog.Handler = (*issuesHandler)(nil)
+
+// issuesHandler is a [slog.Handler] that registers the warning
+// and error log records as issues of the current migration run.
+type issuesHandler struct {
+	next  slog.Handler
+	m     *Migrator
+	attrs []slog.Attr
+}
+
+// Enabled implements [slog.Handler.Enabled].
+func (h *issuesHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+// Handle implements [slog.Handler.Handle].
+func (h *issuesHandler) Handle(ctx context.Context, r slog.Record) error {
+	if run := h.m.run.Load(); run != nil && r.Level >= slog.LevelWarn {
+		attrs := make(map[string]any, len(h.attrs)+r.NumAttrs())
+
+		for _, a := range h.attrs {
+			attrs[a.Key] = a.Value.Any()
+		}
+
+		r.Attrs(func(a slog.Attr) bool {
+			if err, ok := a.Value.Any().(error); ok {
+				attrs[a.Key] = err.Error()
+			} else {
+				attrs[a.Key] = a.Value.Any()
+			}
+			return true
+		})
+
+		run.addIssue(&migrationIssue{
+			Level:   r.Level.String(),
+			Message: r.Message,
+			Attrs:   attrs,
+		})
+	}
+
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements [slog.Handler.WithAttrs].
+func (h *issuesHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &issuesHandler{
+		next:  h.next.WithAttrs(attrs),
+		m:     h.m,
+		attrs: append(slices.Clone(h.attrs), attrs...),
+	}
+}
+
+// WithGroup implements [slog.Handler.WithGroup].
+func (h *issuesHandler) WithGroup(name string) slog.Handler {
+	return &issuesHandler{
+		next:  h.next.WithGroup(name),
+		m:     h.m,
+		attrs: h.attrs,
+	}
+}
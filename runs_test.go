@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestRunsMigrator creates a Migrator that works only with pb_data.
+func newTestRunsMigrator(app core.App) *Migrator {
+	m := &Migrator{pbApp: app, config: &Config{}}
+	m.logger = slog.New(&issuesHandler{next: slog.Default().Handler(), m: m})
+
+	return m
+}
+
+func TestMigrationRunIncrementalSave(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestRunsMigrator(app)
+
+	if err := m.startRun(); err != nil {
+		t.Fatal(err)
+	}
+	runId := m.run.Load().record.Id
+
+	err := m.runStep("users", "users", func() error {
+		// the step is saved before its end
+		run, err := app.FindRecordById(runsCollectionName, runId)
+		if err != nil {
+			return err
+		}
+
+		steps := []stepStats{}
+		if err := run.UnmarshalJSONField("steps", &steps); err != nil {
+			return err
+		}
+		if len(steps) != 1 || steps[0].Name != "users" || steps[0].Status != runStatusRunning {
+			t.Errorf("expected a single running users step, got %v", steps)
+		}
+
+		m.logger.Warn("Test issue", "step", "users", "v2Id", 1)
+
+		// the issue is saved before the end of the run
+		for i := 0; ; i++ {
+			total, err := app.CountRecords(issuesCollectionName, dbx.HashExp{"run": runId})
+			if err != nil {
+				return err
+			}
+			if total == 1 {
+				return nil
+			}
+			if i == 100 {
+				return errors.New("the issue is not saved")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new run while the previous one is still running (eg. killed process)
+	if err := m.startRun(); err != nil {
+		t.Fatal(err)
+	}
+	m.finishRun(nil)
+
+	run, err := app.FindRecordById(runsCollectionName, runId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := run.GetString("status"); status != runStatusInterrupted {
+		t.Fatalf("expected status %q, got %q", runStatusInterrupted, status)
+	}
+
+	steps := []stepStats{}
+	if err := run.UnmarshalJSONField("steps", &steps); err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Status != runStatusSuccess || steps[0].Warnings != 1 {
+		t.Fatalf("expected a single success users step with 1 warning, got %v", steps)
+	}
+}
+
+func TestStartRunOlderRunsCollection(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestRunsMigrator(app)
+
+	// runs collection created by an older version without the interrupted status
+	runs := core.NewBaseCollection(runsCollectionName)
+	runs.System = true
+	runs.Fields.Add(
+		&core.DateField{Name: "started"},
+		&core.DateField{Name: "finished"},
+		&core.SelectField{
+			Name:      "status",
+			Values:    []string{runStatusRunning, runStatusSuccess, runStatusFailed},
+			MaxSelect: 1,
+		},
+		&core.TextField{Name: "configHash"},
+		&core.JSONField{Name: "steps"},
+		&core.TextField{Name: "error"},
+	)
+	if err := app.Save(runs); err != nil {
+		t.Fatal(err)
+	}
+
+	old := core.NewRecord(runs)
+	old.Set("status", runStatusRunning)
+	if err := app.Save(old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.startRun(); err != nil {
+		t.Fatal(err)
+	}
+	m.finishRun(nil)
+
+	runs, err := app.FindCollectionByNameOrId(runsCollectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ := runs.Fields.GetByName("status").(*core.SelectField)
+	if status == nil || !slices.Contains(status.Values, runStatusInterrupted) {
+		t.Fatalf("expected the %q status to be added to the existing collection", runStatusInterrupted)
+	}
+
+	old, err = app.FindRecordById(runsCollectionName, old.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := old.GetString("status"); v != runStatusInterrupted {
+		t.Fatalf("expected status %q, got %q", runStatusInterrupted, v)
+	}
+}
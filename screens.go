@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
@@ -13,6 +14,9 @@ func (m *Migrator) MigrateScreens() error {
 		return err
 	}
 
+	progress := m.startProgress("screens", "Screen")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -22,18 +26,34 @@ func (m *Migrator) MigrateScreens() error {
 		q := m.oldDB.Select("*").
 			From("Screen").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("Screen")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		filesToCopy := make(map[string]string, len(items))
+		imagesToCopy := make([]screenImage, 0, len(items))
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			prototypeId, skip, err := m.resolveRef(refScreenPrototype, "Prototype", item.PrototypeId)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue // dangling reference
+			}
+
+			insertedIds = append(insertedIds, m.buildRecordId("Screen", item.baseModel))
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			record := m.initRecordToMigrate(collection, "Screen", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -44,7 +64,7 @@ func (m *Migrator) MigrateScreens() error {
 			updatedAt, _ := types.ParseDateTime(item.UpdatedAt)
 			record.SetRaw("updated", updatedAt)
 
-			record.Set("prototype", fmt.Sprintf("%s%d", v2Prefix, item.PrototypeId))
+			record.Set("prototype", prototypeId)
 			record.Set("title", item.Title)
 			record.Set("alignment", item.Alignment)
 			record.Set("background", item.Background)
@@ -52,20 +72,36 @@ func (m *Migrator) MigrateScreens() error {
 			record.Set("fixedFooter", item.FixedFooter)
 			record.Set("file", path.Base(item.FilePath))
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
+			saved, err := m.saveRecord(record)
+			if err != nil {
+				err = m.quarantineRow("screens", "Screen", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err))
+				if err == nil {
+					continue
+				}
+
 				// try to copy batched files so that we can continue from where we left
-				if copyErr := m.batchCopyFiles(filesToCopy, 500, "screen_file"); copyErr != nil {
-					return fmt.Errorf("failed to save %q and to copy all screen files: %w; %w", record.Id, err, copyErr)
+				if copyErr := m.copyScreenFiles(collection, filesToCopy, imagesToCopy); copyErr != nil {
+					return fmt.Errorf("%w; failed to copy all screen files: %w", err, copyErr)
 				}
 
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+				return err
 			}
 
+			if !saved {
+				continue
+			}
+
+			m.saveFileMapping(record, "file", item.FilePath)
+
 			// copy later on batches
-			filesToCopy[item.FilePath] = record.BaseFilesPath() + "/" + record.GetString("file")
+			if m.config.ValidateImages {
+				imagesToCopy = append(imagesToCopy, screenImage{Record: record, OldKey: item.FilePath})
+			} else {
+				filesToCopy[item.FilePath] = record.BaseFilesPath() + "/" + record.GetString("file")
+			}
 		}
 
-		if err := m.batchCopyFiles(filesToCopy, 500, "screen_file"); err != nil {
+		if err := m.copyScreenFiles(collection, filesToCopy, imagesToCopy); err != nil {
 			return err
 		}
 
@@ -77,8 +113,25 @@ func (m *Migrator) MigrateScreens() error {
 	}
 
 	if hasOldRecords {
-		return m.deleteMissingRecords(collection, insertedIds)
+		if err := m.deleteMissingRecords(collection, insertedIds); err != nil {
+			return err
+		}
+	}
+
+	if m.idMap != nil {
+		return m.syncScreensOrder()
 	}
 
 	return nil
 }
+
+// copyScreenFiles copies the batched screen files
+// (the images are also validated if the validateImages config is enabled).
+func (m *Migrator) copyScreenFiles(collection *core.Collection, files map[string]string, images []screenImage) error {
+	if len(images) > 0 {
+		// smaller batch because the decoded images could be memory heavy
+		return m.batchCopyScreenImages(collection, images, 50)
+	}
+
+	return m.batchCopyFiles(files, 500, "screens")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// testV2DumpFile is the v2 mysqldump fixture used by the migrator tests.
+const testV2DumpFile = "testdata/v2dump.sql"
+
+// testV2Files lists the v2 storage files referenced by [testV2DumpFile].
+var testV2Files = []string{
+	"users/1/avatar.png",
+	"projects/1/screen1.png",
+	"projects/1/screen2.png",
+}
+
+// testMultipleRelations lists the v3 relation fields that accept multiple records.
+var testMultipleRelations = []string{
+	"projects.users",
+	"prototypes.screensOrder",
+	"hotspotTemplates.screens",
+	"links.onlyPrototypes",
+}
+
+func TestMain(m *testing.M) {
+	// the migrator logs are too verbose for the test output
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	os.Exit(m.Run())
+}
+
+// newTestApp creates a new bootstrapped v3 app in a temp pb_data
+// with the collections and fields from [v3Schema].
+func newTestApp(t *testing.T) core.App {
+	t.Helper()
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+
+	// the relation fields are added after all collections are created
+	// because some of them are circular (eg. prototypes <-> screens)
+	for _, relations := range []bool{false, true} {
+		for _, sc := range v3Schema {
+			collection, err := app.FindCollectionByNameOrId(sc.Name)
+			if err != nil {
+				if sc.Type == core.CollectionTypeAuth {
+					collection = core.NewAuthCollection(sc.Name)
+
+					// the v3 project links are identified only by their username
+					if sc.Name == "links" {
+						collection.Fields.GetByName(core.FieldNameEmail).(*core.EmailField).Required = false
+					}
+				} else {
+					collection = core.NewBaseCollection(sc.Name)
+				}
+			}
+
+			for _, f := range sc.Fields {
+				if (f.Relation != "") != relations {
+					continue
+				}
+				collection.Fields.Add(newTestField(t, app, sc.Name, f))
+			}
+
+			if err := app.Save(collection); err != nil {
+				t.Fatalf("failed to save collection %q: %v", sc.Name, err)
+			}
+		}
+	}
+
+	return app
+}
+
+func newTestField(t *testing.T, app core.App, collectionName string, f v3Field) core.Field {
+	t.Helper()
+
+	switch f.Types[0] {
+	case core.FieldTypeBool:
+		return &core.BoolField{Name: f.Name}
+	case core.FieldTypeNumber:
+		return &core.NumberField{Name: f.Name}
+	case core.FieldTypeJSON:
+		return &core.JSONField{Name: f.Name}
+	case core.FieldTypeFile:
+		return &core.FileField{Name: f.Name, MaxSelect: 1, MaxSize: 5 << 20}
+	case core.FieldTypeRelation:
+		rel, err := app.FindCollectionByNameOrId(f.Relation)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		maxSelect := 1
+		if slices.Contains(testMultipleRelations, collectionName+"."+f.Name) {
+			maxSelect = 999
+		}
+
+		return &core.RelationField{Name: f.Name, CollectionId: rel.Id, MaxSelect: maxSelect}
+	default:
+		return &core.TextField{Name: f.Name}
+	}
+}
+
+// newTestConfig creates a new migrator config for the app that reads
+// the v2 data from [testV2DumpFile] and the v2 files from a temp local storage.
+func newTestConfig(t *testing.T, app core.App) *Config {
+	t.Helper()
+
+	storageDir := t.TempDir()
+	for _, key := range testV2Files {
+		writeTestFile(t, filepath.Join(storageDir, key), testPNG(t, 10, 10))
+	}
+
+	return &Config{
+		V3DataDir:      app.DataDir(),
+		V2DBDriver:     "mysql",
+		V2DumpFile:     testV2DumpFile,
+		V2LocalStorage: storageDir,
+	}
+}
+
+// newTestMigrator creates a new Migrator for the app and config
+// that is closed at the end of the test.
+func newTestMigrator(t *testing.T, app core.App, config *Config) *Migrator {
+	t.Helper()
+
+	m, err := NewMigrator(app, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testPNG returns a new encoded PNG image with the specified size.
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
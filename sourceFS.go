@@ -0,0 +1,344 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// sourceFS defines the read-only v2 files storage.
+//
+// All implementations must return [filesystem.ErrNotFound] for missing files.
+type sourceFS interface {
+	// GetFile returns a content reader for the specified file key.
+	GetFile(key string) (io.ReadCloser, error)
+
+	// Close releases the storage resources.
+	Close() error
+}
+
+// newSourceFS creates the v2 files storage based on the provided config.
+func newSourceFS(config *Config) (sourceFS, error) {
+	switch {
+	case config.V2BundleDir != "":
+		fs, err := filesystem.NewLocal(filepath.Join(config.V2BundleDir, bundleFilesDir))
+		if err != nil {
+			return nil, err
+		}
+		return &systemSource{fs}, nil
+	case config.V2S3Storage.Bucket != "":
+		fs, err := config.V2S3Storage.newFilesystem()
+		if err != nil {
+			return nil, err
+		}
+		return &systemSource{fs}, nil
+	case config.V2HTTPStorage != "":
+		return newHTTPSource(config.V2HTTPStorage)
+	case config.V2ArchiveStorage.Path != "":
+		return newArchiveSource(config.V2ArchiveStorage.Path, config.V2ArchiveStorage.Root)
+	default:
+		fs, err := filesystem.NewLocal(config.V2LocalStorage)
+		if err != nil {
+			return nil, err
+		}
+		return &systemSource{fs}, nil
+	}
+}
+
+// -------------------------------------------------------------------
+
+var _ sourceFS = (*systemSource)(nil)
+
+// systemSource is a [sourceFS] for the local and S3 compatible storages
+// (eg. Google Cloud Storage through its S3 interoperability API).
+type systemSource struct {
+	fs *filesystem.System
+}
+
+// GetFile implements [sourceFS.GetFile].
+func (s *systemSource) GetFile(key string) (io.ReadCloser, error) {
+	return s.fs.GetFile(key)
+}
+
+// Close implements [sourceFS.Close].
+func (s *systemSource) Close() error {
+	return s.fs.Close()
+}
+
+// -------------------------------------------------------------------
+
+var _ sourceFS = (*httpSource)(nil)
+
+// httpSource is a [sourceFS] that reads the v2 files from a base URL
+// (eg. the public v2 storage url or a HTTP gateway in front of a SFTP server).
+type httpSource struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+func newHTTPSource(baseURL string) (*httpSource, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid v2HTTPStorage url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("v2HTTPStorage must be a http or https url")
+	}
+
+	return &httpSource{
+		baseURL: u,
+		client:  &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *httpSource) request(key string) (*http.Response, error) {
+	u := s.baseURL.JoinPath(strings.Split(key, "/")...)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, filesystem.ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &httpStatusError{Status: res.Status, Code: res.StatusCode}
+	}
+
+	return res, nil
+}
+
+// GetFile implements [sourceFS.GetFile].
+func (s *httpSource) GetFile(key string) (io.ReadCloser, error) {
+	res, err := s.request(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// Close implements [sourceFS.Close].
+func (s *httpSource) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// httpStatusError is returned for the non-200 HTTP storage responses.
+type httpStatusError struct {
+	Status string
+	Code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return "unexpected response status " + e.Status
+}
+
+// HTTPStatusCode returns the response status code
+// (used for the file copy errors classification).
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.Code
+}
+
+// -------------------------------------------------------------------
+
+var _ sourceFS = (*archiveSource)(nil)
+
+// archiveEntry holds the location of a single archive file.
+type archiveEntry struct {
+	zipFile *zip.File
+
+	// tar only
+	offset int64
+	size   int64
+}
+
+// archiveSource is a [sourceFS] that reads the v2 files directly
+// from a zip, tar or tar.gz backup of the v2 storage directory.
+//
+// The tar.gz archives are decompressed once in a temp tar file
+// so that the entries could be read in random order.
+type archiveSource struct {
+	file    *os.File
+	zip     *zip.ReadCloser
+	tempTar string
+	entries map[string]*archiveEntry
+}
+
+// newArchiveSource opens the archive at archivePath and indexes
+// all of its files located under the optional root directory.
+func newArchiveSource(archivePath string, root string) (*archiveSource, error) {
+	s := &archiveSource{entries: map[string]*archiveEntry{}}
+
+	root = strings.Trim(root, "/")
+
+	keyFromName := func(name string) (string, bool) {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if root == "" {
+			return name, true
+		}
+		if !strings.HasPrefix(name, root+"/") {
+			return "", false
+		}
+		return strings.TrimPrefix(name, root+"/"), true
+	}
+
+	lowerPath := strings.ToLower(archivePath)
+
+	if strings.HasSuffix(lowerPath, ".zip") {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the v2 zip archive: %w", err)
+		}
+		s.zip = zr
+
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if key, ok := keyFromName(f.Name); ok {
+				s.entries[key] = &archiveEntry{zipFile: f}
+			}
+		}
+
+		return s, nil
+	}
+
+	tarPath := archivePath
+	if strings.HasSuffix(lowerPath, ".tar.gz") || strings.HasSuffix(lowerPath, ".tgz") {
+		var err error
+		tarPath, err = decompressToTempTar(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		s.tempTar = tarPath
+	}
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to open the v2 tar archive: %w", err)
+	}
+	s.file = f
+
+	// index the tar entries
+	counter := &countingReader{r: f}
+	tr := tar.NewReader(counter)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to read the v2 tar archive: %w", err)
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if key, ok := keyFromName(h.Name); ok {
+			s.entries[key] = &archiveEntry{
+				offset: counter.n,
+				size:   h.Size,
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func decompressToTempTar(archivePath string) (string, error) {
+	src, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open the v2 tar.gz archive: %w", err)
+	}
+	defer src.Close()
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the v2 tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+
+	dst, err := os.CreateTemp("", "v2tov3_storage_*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, gz); err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to decompress the v2 tar.gz archive: %w", err)
+	}
+
+	return dst.Name(), nil
+}
+
+// GetFile implements [sourceFS.GetFile].
+func (s *archiveSource) GetFile(key string) (io.ReadCloser, error) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, filesystem.ErrNotFound
+	}
+
+	if entry.zipFile != nil {
+		return entry.zipFile.Open()
+	}
+
+	return io.NopCloser(io.NewSectionReader(s.file, entry.offset, entry.size)), nil
+}
+
+// Close implements [sourceFS.Close].
+func (s *archiveSource) Close() error {
+	var errs []error
+
+	if s.zip != nil {
+		errs = append(errs, s.zip.Close())
+	}
+
+	if s.file != nil {
+		errs = append(errs, s.file.Close())
+	}
+
+	if s.tempTar != "" {
+		errs = append(errs, os.Remove(s.tempTar))
+	}
+
+	return errors.Join(errs...)
+}
+
+// countingReader counts the number of the read bytes.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
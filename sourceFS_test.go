@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// testArchiveFiles are the files of the generated archive fixtures.
+var testArchiveFiles = []struct {
+	name    string
+	content string
+}{
+	{"web/storage/projects/1/a.png", "aaa"},
+	{"web/storage/projects/1/b.png", "bbbbbb"},
+	{"web/storage/users/1/avatar.png", ""},
+	{"other/c.png", "c"},
+}
+
+func writeTestZip(t *testing.T, archivePath string) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	if _, err := zw.Create("web/storage/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range testArchiveFiles {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, file.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, archivePath string, compress bool) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: "web/storage/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range testArchiveFiles {
+		h := &tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.content))}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, file.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveSource(t *testing.T) {
+	dir := t.TempDir()
+
+	zipPath := filepath.Join(dir, "backup.zip")
+	writeTestZip(t, zipPath)
+
+	tarPath := filepath.Join(dir, "backup.tar")
+	writeTestTar(t, tarPath, false)
+
+	tgzPath := filepath.Join(dir, "backup.tar.gz")
+	writeTestTar(t, tgzPath, true)
+
+	rootFiles := map[string]string{
+		"projects/1/a.png":   "aaa",
+		"projects/1/b.png":   "bbbbbb",
+		"users/1/avatar.png": "",
+	}
+
+	allFiles := map[string]string{
+		"web/storage/projects/1/a.png":   "aaa",
+		"web/storage/projects/1/b.png":   "bbbbbb",
+		"web/storage/users/1/avatar.png": "",
+		"other/c.png":                    "c",
+	}
+
+	rootMissing := []string{"other/c.png", "web/storage/projects/1/a.png", "projects/1/missing.png", "projects"}
+
+	scenarios := []struct {
+		name     string
+		path     string
+		root     string
+		expected map[string]string
+		missing  []string
+	}{
+		{"zip with root", zipPath, "web/storage", rootFiles, rootMissing},
+		{"zip without root", zipPath, "", allFiles, []string{"projects/1/a.png", "web/storage"}},
+		{"tar with root", tarPath, "/web/storage/", rootFiles, rootMissing},
+		{"tar without root", tarPath, "", allFiles, []string{"projects/1/a.png", "web/storage"}},
+		{"tar.gz with root", tgzPath, "web/storage", rootFiles, rootMissing},
+		{"tar.gz without root", tgzPath, "", allFiles, []string{"projects/1/a.png", "web/storage"}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			src, err := newArchiveSource(s.path, s.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(src.entries) != len(s.expected) {
+				t.Errorf("expected %d indexed entries, got %d", len(s.expected), len(src.entries))
+			}
+
+			// read in reverse order to check the random access
+			keys := slices.Sorted(maps.Keys(s.expected))
+			slices.Reverse(keys)
+			for _, key := range keys {
+				r, err := src.GetFile(key)
+				if err != nil {
+					t.Fatalf("failed to open %q: %v", key, err)
+				}
+				data, err := io.ReadAll(r)
+				r.Close()
+				if err != nil {
+					t.Fatalf("failed to read %q: %v", key, err)
+				}
+				if string(data) != s.expected[key] {
+					t.Errorf("expected %q content %q, got %q", key, s.expected[key], data)
+				}
+			}
+
+			for _, key := range s.missing {
+				if _, err := src.GetFile(key); !errors.Is(err, filesystem.ErrNotFound) {
+					t.Errorf("expected ErrNotFound for %q, got %v", key, err)
+				}
+			}
+
+			tempTar := src.tempTar
+
+			if err := src.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if tempTar != "" {
+				if _, err := os.Stat(tempTar); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected the temp tar %q to be removed, got %v", tempTar, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/storage/projects/1/a%20b.png":
+			io.WriteString(w, "ab")
+		case "/storage/projects/1/error.png":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := newHTTPSource("ftp://example.com/storage"); err == nil {
+		t.Fatal("expected error for a non http url")
+	}
+
+	src, err := newHTTPSource(server.URL + "/storage/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	scenarios := []struct {
+		key        string
+		content    string
+		notFound   bool
+		statusCode int
+	}{
+		{"projects/1/a b.png", "ab", false, 0},
+		{"projects/1/missing.png", "", true, 0},
+		{"projects/1/error.png", "", false, http.StatusBadGateway},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.key, func(t *testing.T) {
+			r, err := src.GetFile(s.key)
+
+			if s.notFound {
+				if !errors.Is(err, filesystem.ErrNotFound) {
+					t.Fatalf("expected ErrNotFound, got %v", err)
+				}
+				return
+			}
+
+			if s.statusCode != 0 {
+				var statusErr *httpStatusError
+				if !errors.As(err, &statusErr) || statusErr.HTTPStatusCode() != s.statusCode {
+					t.Fatalf("expected status error %d, got %v", s.statusCode, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != s.content {
+				t.Fatalf("expected content %q, got %q", s.content, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// S3Storage defines the S3 storage settings.
+type S3Storage struct {
+	Bucket         string `json:"bucket,omitempty"`
+	Region         string `json:"region,omitempty"`
+	Endpoint       string `json:"endpoint,omitempty"`
+	AccessKey      string `json:"accessKey,omitempty"`
+	Secret         string `json:"secret,omitempty"`
+	ForcePathStyle bool   `json:"forcePathStyle,omitempty"`
+}
+
+// newFilesystem creates a new S3 filesystem from the current settings.
+func (s S3Storage) newFilesystem() (*filesystem.System, error) {
+	return filesystem.NewS3(s.Bucket, s.Region, s.Endpoint, s.AccessKey, s.Secret, s.ForcePathStyle)
+}
+
+// V3Storage defines the optional v3 storage override
+// (eg. to migrate to a different S3 bucket or to stage the files locally).
+//
+// Only one of Local or S3 could be set.
+type V3Storage struct {
+	// Local is the local storage directory path.
+	Local string `json:"local,omitempty"`
+
+	S3 S3Storage `json:"s3"`
+
+	// UpdateSettings updates the pb_data storage settings to match
+	// the override once the migration completes.
+	UpdateSettings bool `json:"updateSettings,omitempty"`
+}
+
+// IsSet reports whether a v3 storage override is configured.
+func (s V3Storage) IsSet() bool {
+	return s.Local != "" || s.S3.Bucket != ""
+}
+
+// Validate checks whether the v3 storage override is valid.
+func (s V3Storage) Validate() error {
+	if s.Local != "" && s.S3.Bucket != "" {
+		return errors.New("only one of v3Storage.local or v3Storage.s3 must be set")
+	}
+
+	if s.UpdateSettings && !s.IsSet() {
+		return errors.New("v3Storage.updateSettings requires v3Storage.local or v3Storage.s3 to be set")
+	}
+
+	return nil
+}
+
+// newV3Filesystem creates the v3 files storage based on the v3Storage
+// override or fallbacks to the app configured storage.
+func newV3Filesystem(app core.App, config *Config) (*filesystem.System, error) {
+	switch {
+	case config.V3Storage.S3.Bucket != "":
+		return config.V3Storage.S3.newFilesystem()
+	case config.V3Storage.Local != "":
+		return filesystem.NewLocal(config.V3Storage.Local)
+	default:
+		return app.NewFilesystem()
+	}
+}
+
+// UpdateStorageSettings updates the pb_data storage settings to match the v3Storage override
+// (if v3Storage.updateSettings is enabled).
+//
+// Note that PocketBase always reads the local files from "pb_data/storage",
+// so for a custom local directory the files must be moved there manually.
+func (m *Migrator) UpdateStorageSettings() error {
+	storage := m.config.V3Storage
+	if !storage.UpdateSettings {
+		return nil
+	}
+
+	settings, err := m.pbApp.Settings().Clone()
+	if err != nil {
+		return err
+	}
+
+	if storage.S3.Bucket != "" {
+		settings.S3 = core.S3Config{
+			Enabled:        true,
+			Bucket:         storage.S3.Bucket,
+			Region:         storage.S3.Region,
+			Endpoint:       storage.S3.Endpoint,
+			AccessKey:      storage.S3.AccessKey,
+			Secret:         storage.S3.Secret,
+			ForcePathStyle: storage.S3.ForcePathStyle,
+		}
+	} else {
+		settings.S3.Enabled = false
+
+		defaultDir := filepath.Join(m.pbApp.DataDir(), core.LocalStorageDirName)
+		if abs, _ := filepath.Abs(storage.Local); abs != "" {
+			if defaultAbs, _ := filepath.Abs(defaultDir); abs != defaultAbs {
+				m.logger.Warn(
+					"The v3 files were written in a custom local directory and must be moved manually",
+					"step", "storageSettings",
+					"from", storage.Local,
+					"to", defaultDir,
+				)
+			}
+		}
+	}
+
+	if err := m.pbApp.Save(settings); err != nil {
+		return err
+	}
+
+	m.logger.Info("Updated the pb_data storage settings", "s3", settings.S3.Enabled)
+
+	return nil
+}
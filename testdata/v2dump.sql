@@ -0,0 +1,186 @@
+-- Minimal Presentator v2 mysqldump fixture used by the migrator tests.
+
+CREATE TABLE `migration` (
+  `version` varchar(180) NOT NULL,
+  `apply_time` int(11) DEFAULT NULL,
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `migration` VALUES ('m000000_000000_base',1600000000),('m200000_000000_v2',1600000001);
+
+DROP TABLE IF EXISTS `User`;
+CREATE TABLE `User` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `type` varchar(255) DEFAULT NULL,
+  `email` varchar(255) DEFAULT NULL,
+  `passwordHash` varchar(255) DEFAULT NULL,
+  `passwordResetToken` varchar(255) DEFAULT NULL,
+  `authKey` varchar(255) DEFAULT NULL,
+  `firstName` varchar(255) DEFAULT NULL,
+  `lastName` varchar(255) DEFAULT NULL,
+  `avatarFilePath` varchar(255) DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `UserAuth`;
+CREATE TABLE `UserAuth` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `userId` int(11) DEFAULT NULL,
+  `source` varchar(255) DEFAULT NULL,
+  `sourceId` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `Project`;
+CREATE TABLE `Project` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `title` varchar(255) DEFAULT NULL,
+  `archived` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `UserProjectRel`;
+CREATE TABLE `UserProjectRel` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `userId` int(11) DEFAULT NULL,
+  `projectId` int(11) DEFAULT NULL,
+  `pinned` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `Prototype`;
+CREATE TABLE `Prototype` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `projectId` int(11) DEFAULT NULL,
+  `title` varchar(255) DEFAULT NULL,
+  `type` varchar(255) DEFAULT NULL,
+  `width` float DEFAULT NULL,
+  `height` float DEFAULT NULL,
+  `scaleFactor` float DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `Screen`;
+CREATE TABLE `Screen` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `prototypeId` int(11) DEFAULT NULL,
+  `order` int(11) DEFAULT NULL,
+  `title` varchar(255) DEFAULT NULL,
+  `alignment` varchar(255) DEFAULT NULL,
+  `background` varchar(255) DEFAULT NULL,
+  `fixedHeader` float DEFAULT NULL,
+  `fixedFooter` float DEFAULT NULL,
+  `filePath` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `ScreenComment`;
+CREATE TABLE `ScreenComment` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `replyTo` int(11) DEFAULT NULL,
+  `screenId` int(11) DEFAULT NULL,
+  `from` varchar(255) DEFAULT NULL,
+  `message` text,
+  `left` float DEFAULT NULL,
+  `top` float DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `HotspotTemplate`;
+CREATE TABLE `HotspotTemplate` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `prototypeId` int(11) DEFAULT NULL,
+  `title` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `HotspotTemplateScreenRel`;
+CREATE TABLE `HotspotTemplateScreenRel` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `hotspotTemplateId` int(11) DEFAULT NULL,
+  `screenId` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `Hotspot`;
+CREATE TABLE `Hotspot` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `screenId` int(11) DEFAULT NULL,
+  `hotspotTemplateId` int(11) DEFAULT NULL,
+  `type` varchar(255) DEFAULT NULL,
+  `left` float DEFAULT NULL,
+  `top` float DEFAULT NULL,
+  `width` float DEFAULT NULL,
+  `height` float DEFAULT NULL,
+  `settings` text,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `ProjectLink`;
+CREATE TABLE `ProjectLink` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `projectId` int(11) DEFAULT NULL,
+  `slug` varchar(255) DEFAULT NULL,
+  `passwordHash` varchar(255) DEFAULT NULL,
+  `allowComments` int(11) DEFAULT NULL,
+  `allowGuideline` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `ProjectLinkPrototypeRel`;
+CREATE TABLE `ProjectLinkPrototypeRel` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `projectLinkId` int(11) DEFAULT NULL,
+  `prototypeId` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `UserScreenCommentRel`;
+CREATE TABLE `UserScreenCommentRel` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `createdAt` datetime DEFAULT NULL,
+  `updatedAt` datetime DEFAULT NULL,
+  `userId` int(11) DEFAULT NULL,
+  `screenCommentId` int(11) DEFAULT NULL,
+  `isRead` int(11) DEFAULT NULL,
+  `isProcessed` int(11) DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+INSERT INTO `User` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00','super','john@example.com','$2y$13$Jh5MzHWJ2Hq7hKh2ZPPlBOqd6bNWv5f5rX3dG6y6l1eZfU1JWQm7a',NULL,'abc','John','Doe','users/1/avatar.png','active'),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00','regular','jane@example.com','$2y$13$Jh5MzHWJ2Hq7hKh2ZPPlBOqd6bNWv5f5rX3dG6y6l1eZfU1JWQm7a',NULL,'def','Jane',NULL,'','inactive');
+INSERT INTO `Project` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00','Test project',0);
+INSERT INTO `UserProjectRel` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,1,1),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',2,1,0);
+INSERT INTO `Prototype` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,'Web','desktop',0,0,1);
+INSERT INTO `Screen` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,2,'Home','center','#ffffff',0,0,'projects/1/screen1.png'),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,1,'About','left','#000000',10,20,'projects/1/screen2.png');
+INSERT INTO `ScreenComment` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',NULL,1,'john@example.com','Hello \'world\'',10,20,'pending'),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,1,'guest@example.com','Reply',10,20,'resolved');
+INSERT INTO `HotspotTemplate` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,'Menu');
+INSERT INTO `HotspotTemplateScreenRel` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,1),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,2);
+INSERT INTO `Hotspot` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,NULL,'screen',1,2,30,40,'{\"screenId\":2,\"transition\":\"none\"}'),(2,'2023-01-01 10:00:00','2023-01-02 10:00:00',NULL,1,'back',5,5,10,10,'{}');
+INSERT INTO `ProjectLink` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,'abc123',NULL,1,0);
+INSERT INTO `ProjectLinkPrototypeRel` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',1,1);
+INSERT INTO `UserScreenCommentRel` VALUES (1,'2023-01-01 10:00:00','2023-01-02 10:00:00',2,1,0,0);
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"sync/atomic"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultThumbSizes are the thumb sizes that PocketBase serves for every file field
+// (in addition to the field specific ones).
+var defaultThumbSizes = []string{"100x100"}
+
+// thumbContentTypes are the image content types that PocketBase creates thumbs for.
+var thumbContentTypes = []string{"image/png", "image/jpg", "image/jpeg", "image/gif"}
+
+// GenerateScreenThumbs pre-generates the thumbs of all migrated screens
+// for each thumb size of the v3 screens file field.
+//
+// The thumbs are written in the PocketBase thumbs layout
+// ("{baseFilesPath}/thumbs_{file}/{size}_{file}") so that v3 serves them directly.
+// Already existing thumbs are skipped and the failures are only logged.
+func (m *Migrator) GenerateScreenThumbs() error {
+	collection, err := m.pbApp.FindCollectionByNameOrId("screens")
+	if err != nil {
+		return err
+	}
+
+	sizes := slices.Clone(defaultThumbSizes)
+	if field, ok := collection.Fields.GetByName("file").(*core.FileField); ok {
+		for _, size := range field.Thumbs {
+			if !slices.Contains(sizes, size) {
+				sizes = append(sizes, size)
+			}
+		}
+	}
+
+	total, err := m.pbApp.CountRecords(collection, m.sourceRecordsExp())
+	if err != nil {
+		m.logger.Warn("Failed to count the v3 screens", "step", "thumbs", "error", err)
+	}
+
+	progress := m.startProgressWithTotal("thumbs", total)
+	defer progress.finish()
+
+	var created, skipped, failed atomic.Int64
+
+	limit := 1000
+	for i := 0; ; i++ {
+		records := make([]*core.Record, 0, limit)
+		err := m.pbApp.RecordQuery(collection).
+			AndWhere(m.sourceRecordsExp()).
+			OrderBy("id asc").
+			Limit(int64(limit)).
+			Offset(int64(i * limit)).
+			All(&records)
+		if err != nil {
+			return err
+		}
+
+		var thumbsGroup errgroup.Group
+
+		thumbsGroup.SetLimit(runtime.NumCPU())
+
+		for _, record := range records {
+			record := record
+			thumbsGroup.Go(func() error {
+				defer progress.add(1)
+
+				file := record.GetString("file")
+				if file == "" {
+					return nil
+				}
+
+				originalKey := record.BaseFilesPath() + "/" + file
+
+				attrs, err := m.newFS.Attributes(originalKey)
+				if err != nil {
+					failed.Add(int64(len(sizes)))
+					m.logger.Warn("Failed to read the screen file", "step", "thumbs", "v3Id", record.Id, "newFileKey", originalKey, "error", err)
+					return nil
+				}
+
+				if !slices.Contains(thumbContentTypes, attrs.ContentType) {
+					return nil // PocketBase doesn't create thumbs for it
+				}
+
+				for _, size := range sizes {
+					thumbKey := record.BaseFilesPath() + "/thumbs_" + file + "/" + size + "_" + file
+
+					if exists, _ := m.newFS.Exists(thumbKey); exists {
+						skipped.Add(1)
+						continue // already generated
+					}
+
+					err := m.retry("v3 thumb create", func() error {
+						return m.newFS.CreateThumb(originalKey, thumbKey, size)
+					})
+					if err != nil {
+						failed.Add(1)
+						m.logger.Warn("Failed to create screen thumb", "step", "thumbs", "v3Id", record.Id, "thumbKey", thumbKey, "error", err)
+						continue
+					}
+
+					created.Add(1)
+					m.logger.Debug("Created screen thumb", "step", "thumbs", "v3Id", record.Id, "thumbKey", thumbKey)
+				}
+
+				return nil
+			})
+		}
+
+		if err := thumbsGroup.Wait(); err != nil {
+			return err
+		}
+
+		if len(records) < limit {
+			break // no more records
+		}
+	}
+
+	m.logger.Info(
+		"Screen thumbs summary",
+		"step", "thumbs",
+		"sizes", sizes,
+		"created", created.Load(),
+		"skipped", skipped.Load(),
+		"failed", failed.Load(),
+	)
+
+	return nil
+}
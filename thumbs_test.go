@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGenerateScreenThumbs(t *testing.T) {
+	app := newTestApp(t)
+
+	m := newTestMigrator(t, app, newTestConfig(t, app))
+	if err := m.MigrateAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the progress total should count the v3 screens and not the v2 rows
+	screen, err := app.FindRecordById("screens", "pr2_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(screen); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.GenerateScreenThumbs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if total := m.progress.total; total != 1 {
+		t.Fatalf("expected progress total 1, got %d", total)
+	}
+
+	if rows := m.progress.rows.Load(); rows != 1 {
+		t.Fatalf("expected 1 processed screen, got %d", rows)
+	}
+
+	screen, err = app.FindRecordById("screens", "pr2_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbKey := screen.BaseFilesPath() + "/thumbs_screen1.png/100x100_screen1.png"
+	if exists, err := m.newFS.Exists(thumbKey); err != nil || !exists {
+		t.Fatalf("expected thumb %q to exist (%v)", thumbKey, err)
+	}
+}
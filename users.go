@@ -18,6 +18,9 @@ func (m *Migrator) MigrateUsers() error {
 		return err
 	}
 
+	progress := m.startProgress("users", "User")
+	defer progress.finish()
+
 	hasOldRecords := m.isNotEmptyCollection(collection)
 	insertedIds := make([]string, 0, 1000)
 
@@ -27,18 +30,34 @@ func (m *Migrator) MigrateUsers() error {
 		q := m.oldDB.Select("*").
 			From("User").
 			OrderBy("id asc").
+			AndWhere(m.quarantinedRowsExp("User")).
 			Limit(int64(limit)).
 			Offset(int64(i * limit))
-		if err := q.All(&items); err != nil {
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
 			return err
 		}
 
 		filesToCopy := make(map[string]string, len(items))
 
 		for _, item := range items {
-			insertedIds = append(insertedIds, m.buildRecordId(item.baseModel))
+			progress.add(1)
+
+			if m.config.MergeUsersByEmail {
+				// link to the existing v3 user with the same email (eg. from another v2 installation)
+				if existingId := m.mergedUserId(collection, item); existingId != "" {
+					m.mergedUsers[item.Id] = existingId
+					m.logger.Debug("Merged v2 user with an existing v3 user", "step", "users", "v2Id", item.Id, "v3Id", existingId)
+					continue
+				}
+			}
 
-			record := m.initRecordToMigrate(collection, item.baseModel)
+			insertedIds = append(insertedIds, m.buildRecordId("User", item.baseModel))
+
+			record := m.initRecordToMigrate(collection, "User", item.baseModel)
 			if record == nil {
 				continue // already migrated
 			}
@@ -52,7 +71,7 @@ func (m *Migrator) MigrateUsers() error {
 			record.SetVerified(item.Status == "active")
 			record.SetEmail(item.Email)
 			record.SetEmailVisibility(false)
-			record.SetRaw("password", item.PasswordHash)
+			record.SetRaw("password", &core.PasswordFieldValue{Hash: item.PasswordHash})
 			record.RefreshTokenKey()
 
 			// generate username
@@ -68,22 +87,32 @@ func (m *Migrator) MigrateUsers() error {
 			oldAvatarKey := cast.ToString(*item.AvatarFilePath)
 			if oldAvatarKey != "" {
 				record.Set("avatar", path.Base(oldAvatarKey))
-
-				// copy later on batches
-				filesToCopy[oldAvatarKey] = record.BaseFilesPath() + "/" + record.GetString("avatar")
 			}
 
-			if err := m.pbApp.SaveNoValidate(record); err != nil {
+			saved, err := m.saveRecord(record)
+			if err != nil {
+				err = m.quarantineRow("users", "User", item.Id, item, fmt.Errorf("failed to save %q: %w", record.Id, err))
+				if err == nil {
+					continue
+				}
+
 				// try to copy batched files so that we can continue from where we left
-				if copyErr := m.batchCopyFiles(filesToCopy, 500, "user_avatars"); copyErr != nil {
-					return fmt.Errorf("failed to save %q and to copy all user avatars: %w; %w", record.Id, err, copyErr)
+				if copyErr := m.batchCopyFiles(filesToCopy, 500, "users"); copyErr != nil {
+					return fmt.Errorf("%w; failed to copy all user avatars: %w", err, copyErr)
 				}
 
-				return fmt.Errorf("failed to save %q: %w", record.Id, err)
+				return err
+			}
+
+			if saved && oldAvatarKey != "" {
+				m.saveFileMapping(record, "avatar", oldAvatarKey)
+
+				// copy later on batches
+				filesToCopy[oldAvatarKey] = record.BaseFilesPath() + "/" + record.GetString("avatar")
 			}
 		}
 
-		if err := m.batchCopyFiles(filesToCopy, 500, "user_avatars"); err != nil {
+		if err := m.batchCopyFiles(filesToCopy, 500, "users"); err != nil {
 			return err
 		}
 
@@ -121,3 +150,57 @@ func suggestUniqueAuthRecordUsername(
 
 	return username
 }
+
+// mergedUserId returns the id of the existing v3 user with the same email as the v2 user
+// (or empty string if there is no such user or it is the v2 user itself).
+func (m *Migrator) mergedUserId(collection *core.Collection, item *v2User) string {
+	existing := &core.Record{}
+
+	err := m.pbApp.RecordQuery(collection).
+		AndWhere(dbx.NewExp("LOWER([[email]])={:email}", dbx.Params{"email": strings.ToLower(item.Email)})).
+		Limit(1).
+		One(existing)
+	if err != nil || existing.Id == m.buildRecordId("User", item.baseModel) {
+		return ""
+	}
+
+	return existing.Id
+}
+
+// loadMergedUsers resolves the merged users of all v2 users without migrating them
+// (used when the users step is not executed for all rows, see [Migrator.RetryQuarantine]).
+func (m *Migrator) loadMergedUsers() error {
+	collection, err := m.pbApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+
+	limit := 1000
+	items := make([]*v2User, 0, limit)
+	for i := 0; ; i++ {
+		q := m.oldDB.Select("id", "email").
+			From("User").
+			OrderBy("id asc").
+			Limit(int64(limit)).
+			Offset(int64(i * limit))
+		err := m.retry("v2 query", func() error {
+			items = items[:0]
+			return q.All(&items)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if existingId := m.mergedUserId(collection, item); existingId != "" {
+				m.mergedUsers[item.Id] = existingId
+			}
+		}
+
+		if len(items) < limit {
+			break // no more items
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/spf13/cast"
+)
+
+// Supported source versions.
+const (
+	sourceV1 = "v1"
+	sourceV2 = "v2"
+)
+
+// v1HotspotsPerScreen is the max number of hotspots per v1 screen.
+//
+// The v1 hotspots are stored as a JSON object in the Screen row and don't
+// have their own ids so they are generated from the screen id and the
+// hotspot position (screenId*v1HotspotsPerScreen + index + 1).
+const v1HotspotsPerScreen = 1000
+
+// v1Table describes a single v1 table read by the adapter.
+type v1Table struct {
+	Name string
+
+	// Columns lists the columns that are required for the conversion
+	// (the other columns are read only if they exist).
+	Columns []string
+
+	// Optional indicates whether the table could be missing.
+	Optional bool
+}
+
+// v1Tables lists the v1 tables read by the adapter.
+var v1Tables = []v1Table{
+	{Name: "User", Columns: []string{"id", "email", "passwordHash", "authKey", "status", "type", "createdAt", "updatedAt"}},
+	{Name: "UserAuth", Columns: []string{"id", "userId", "source", "sourceId"}, Optional: true},
+	{Name: "Project", Columns: []string{"id", "title", "createdAt", "updatedAt"}},
+	{Name: "UserProjectRel", Columns: []string{"id", "userId", "projectId"}},
+	{Name: "Version", Columns: []string{"id", "projectId", "type", "createdAt", "updatedAt"}},
+	{Name: "Screen", Columns: []string{"id", "versionId", "imageUrl", "hotspots", "createdAt", "updatedAt"}},
+	{Name: "ScreenComment", Columns: []string{"id", "screenId", "replyTo", "from", "message", "posX", "posY", "createdAt", "updatedAt"}},
+	{Name: "UserScreenCommentRel", Columns: []string{"id", "userId", "screenCommentId"}, Optional: true},
+	{Name: "ProjectPreview", Columns: []string{"id", "projectId", "slug", "type"}, Optional: true},
+	{Name: "migration", Columns: []string{"version", "apply_time"}, Optional: true},
+}
+
+// v1 Version types and their default sizes.
+var v1VersionTypes = map[int]string{1: "desktop", 2: "tablet", 3: "mobile"}
+
+var v1DefaultSizes = map[string][2]int{
+	"tablet": {768, 1024},
+	"mobile": {375, 667},
+}
+
+// v1Subtypes maps the v1 tablet and mobile Version subtypes to their size.
+var v1Subtypes = map[int][2]int{
+	21: {768, 1024},
+	22: {1024, 768},
+	23: {800, 1200},
+	24: {1200, 800},
+	31: {320, 480},
+	32: {480, 320},
+	33: {375, 667},
+	34: {667, 375},
+	35: {412, 732},
+	36: {732, 412},
+	37: {414, 736},
+	38: {736, 414},
+}
+
+var v1Alignments = map[int]string{1: "left", 2: "center", 3: "right"}
+
+// v1Row is a single v1 table row.
+//
+// Missing columns are read as empty values.
+type v1Row dbx.NullStringMap
+
+func (r v1Row) str(col string) string {
+	return r[col].String
+}
+
+func (r v1Row) integer(col string) int {
+	switch v := r[col].String; v {
+	case "t", "true":
+		return 1
+	case "f", "false":
+		return 0
+	default:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+}
+
+func (r v1Row) float(col string) float64 {
+	n, _ := strconv.ParseFloat(r[col].String, 64)
+	return n
+}
+
+// nullable returns nil for NULL and missing columns.
+func (r v1Row) nullable(col string) any {
+	if v := r[col]; v.Valid {
+		return v.String
+	}
+
+	return nil
+}
+
+// date converts the v1 unix timestamp column to a v2 datetime string.
+func (r v1Row) date(col string) any {
+	unix, err := strconv.ParseInt(r[col].String, 10, 64)
+	if err != nil || unix <= 0 {
+		return nil
+	}
+
+	return time.Unix(unix, 0).UTC().Format(time.DateTime)
+}
+
+// v1StorageKey converts a v1 file url (eg. "/uploads/projects/abc/image.png")
+// to a storage key relative to the v1 "web" directory.
+func v1StorageKey(fileUrl string) string {
+	if u, err := url.Parse(fileUrl); err == nil && u.Scheme != "" {
+		fileUrl = u.Path
+	}
+
+	return strings.TrimLeft(fileUrl, "/")
+}
+
+// v1Adapter converts the v1 tables into the [v2Tables] of a temporary store.
+type v1Adapter struct {
+	m      *Migrator
+	v1DB   *dbx.DB
+	loader *dumpLoader
+
+	// existing holds the available v1 tables
+	existing map[string]bool
+
+	// projectPasswords holds the v1 project passwords
+	// (in v2 they are stored per project link)
+	projectPasswords map[int]any
+}
+
+// loadV1Source converts the opened v1 DB (m.oldDB) into a new temporary
+// SQLite store with the v2 schema and replaces m.oldDB with it.
+//
+// The v1 DB connection is closed after the conversion.
+func (m *Migrator) loadV1Source() error {
+	v1DB := m.oldDB
+	defer v1DB.Close()
+
+	a := &v1Adapter{
+		m:                m,
+		v1DB:             v1DB,
+		loader:           newDumpLoader(nil, "sqlite"),
+		existing:         map[string]bool{},
+		projectPasswords: map[int]any{},
+	}
+
+	if err := a.checkSchema(); err != nil {
+		return err
+	}
+
+	store, storePath, err := newTempStore()
+	if err != nil {
+		return err
+	}
+
+	if err := a.loader.run(store.DB(), a.convertAll); err != nil {
+		store.Close()
+		os.Remove(storePath)
+		return fmt.Errorf("failed to convert the v1 data: %w", err)
+	}
+
+	for _, t := range a.loader.tables {
+		m.logger.Debug("Converted v1 table", "table", t.name, "rows", t.rows)
+	}
+
+	m.oldDB = store
+	m.dumpStore = storePath
+
+	return nil
+}
+
+// checkSchema checks whether the required [v1Tables] and columns exist.
+func (a *v1Adapter) checkSchema() error {
+	existing, err := a.m.v2SchemaColumns()
+	if err != nil {
+		return fmt.Errorf("failed to inspect the Presentator v1 schema: %w", err)
+	}
+
+	var problems []string
+
+	for _, table := range v1Tables {
+		columns, ok := existing[a.m.normalizeV2TableName(table.Name)]
+		if !ok {
+			if !table.Optional {
+				problems = append(problems, fmt.Sprintf("missing table %q", table.Name))
+			}
+			continue
+		}
+
+		a.existing[table.Name] = true
+
+		for _, col := range table.Columns {
+			if !slices.Contains(columns, col) {
+				problems = append(problems, fmt.Sprintf("missing column %s.%s", table.Name, col))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("incompatible Presentator v1 schema (only the latest v1.x releases are supported):\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
+
+func (a *v1Adapter) convertAll() error {
+	// create all tables upfront so that the store has the full v2 schema
+	for _, t := range a.loader.known {
+		if _, err := a.loader.table(t.Name, t.Columns()); err != nil {
+			return err
+		}
+	}
+
+	steps := []struct {
+		table string
+		fn    func(row v1Row) error
+	}{
+		{"User", a.convertUser},
+		{"UserAuth", a.convertUserAuth},
+		{"Project", a.convertProject},
+		{"UserProjectRel", a.convertUserProjectRel},
+		{"Version", a.convertVersion},
+		{"Screen", a.convertScreen},
+		{"ScreenComment", a.convertScreenComment},
+		{"UserScreenCommentRel", a.convertUserScreenCommentRel},
+		{"ProjectPreview", a.convertProjectPreview},
+		{"migration", a.convertMigration},
+	}
+
+	for _, step := range steps {
+		if !a.existing[step.table] {
+			continue // optional table
+		}
+
+		if err := a.each(step.table, step.fn); err != nil {
+			return fmt.Errorf("%s: %w", step.table, err)
+		}
+	}
+
+	return nil
+}
+
+// each calls fn for every row of the v1 table (the rows are read on pages).
+func (a *v1Adapter) each(table string, fn func(row v1Row) error) error {
+	orderBy := "id asc"
+	if table == "migration" {
+		orderBy = "version asc"
+	}
+
+	limit := 1000
+	rows := make([]dbx.NullStringMap, 0, limit)
+	for i := 0; ; i++ {
+		q := a.v1DB.Select("*").
+			From(table).
+			OrderBy(orderBy).
+			Limit(int64(limit)).
+			Offset(int64(i * limit))
+		err := a.m.retry("v1 query", func() error {
+			rows = rows[:0]
+			return q.All(&rows)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := fn(v1Row(row)); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < limit {
+			return nil // no more rows
+		}
+	}
+}
+
+// insert inserts a single row in the v2 store table.
+//
+// The missing v2 columns are set to NULL.
+func (a *v1Adapter) insert(table string, values dbx.Params) error {
+	t := a.loader.tables[strings.ToLower(table)]
+
+	row := make([]any, len(t.columns))
+	for i, col := range t.columns {
+		row[i] = values[col]
+	}
+
+	return a.loader.insert(t, t.columns, row)
+}
+
+func (a *v1Adapter) convertUser(row v1Row) error {
+	status := "inactive"
+	if row.integer("status") == 1 {
+		status = "active"
+	}
+
+	userType := "regular"
+	if row.integer("type") == 1 {
+		userType = "super"
+	}
+
+	return a.insert("User", dbx.Params{
+		"id":                 row.integer("id"),
+		"type":               userType,
+		"email":              row.str("email"),
+		"passwordHash":       row.str("passwordHash"),
+		"passwordResetToken": row.nullable("passwordResetToken"),
+		"authKey":            row.str("authKey"),
+		"firstName":          row.nullable("firstName"),
+		"lastName":           row.nullable("lastName"),
+		"avatarFilePath":     v1StorageKey(row.str("avatarFilePath")),
+		"status":             status,
+		"createdAt":          row.date("createdAt"),
+		"updatedAt":          row.date("updatedAt"),
+	})
+}
+
+func (a *v1Adapter) convertUserAuth(row v1Row) error {
+	return a.insert("UserAuth", dbx.Params{
+		"id":        row.integer("id"),
+		"userId":    row.integer("userId"),
+		"source":    row.str("source"),
+		"sourceId":  row.str("sourceId"),
+		"createdAt": row.date("createdAt"),
+		"updatedAt": row.date("updatedAt"),
+	})
+}
+
+func (a *v1Adapter) convertProject(row v1Row) error {
+	if hash := row.str("passwordHash"); hash != "" {
+		a.projectPasswords[row.integer("id")] = hash
+	}
+
+	return a.insert("Project", dbx.Params{
+		"id":        row.integer("id"),
+		"title":     row.str("title"),
+		"archived":  0,
+		"createdAt": row.date("createdAt"),
+		"updatedAt": row.date("updatedAt"),
+	})
+}
+
+func (a *v1Adapter) convertUserProjectRel(row v1Row) error {
+	return a.insert("UserProjectRel", dbx.Params{
+		"id":        row.integer("id"),
+		"userId":    row.integer("userId"),
+		"projectId": row.integer("projectId"),
+		"pinned":    0,
+		"createdAt": row.date("createdAt"),
+		"updatedAt": row.date("updatedAt"),
+	})
+}
+
+// convertVersion converts a v1 project Version to a v2 Prototype.
+func (a *v1Adapter) convertVersion(row v1Row) error {
+	versionType := v1VersionTypes[row.integer("type")]
+	if versionType == "" {
+		versionType = "desktop"
+	}
+
+	var width, height int
+	if versionType != "desktop" {
+		size, ok := v1Subtypes[row.integer("subtype")]
+		if !ok {
+			size = v1DefaultSizes[versionType]
+		}
+		width, height = size[0], size[1]
+	}
+
+	scaleFactor := 1.0
+	if _, ok := row["scaleFactor"]; ok {
+		scaleFactor = row.float("scaleFactor")
+	}
+
+	title := row.str("title")
+	if title == "" {
+		title = fmt.Sprintf("Version %d", row.integer("id"))
+	}
+
+	return a.insert("Prototype", dbx.Params{
+		"id":          row.integer("id"),
+		"projectId":   row.integer("projectId"),
+		"title":       title,
+		"type":        versionType,
+		"width":       width,
+		"height":      height,
+		"scaleFactor": scaleFactor,
+		"createdAt":   row.date("createdAt"),
+		"updatedAt":   row.date("updatedAt"),
+	})
+}
+
+// convertScreen converts a v1 Screen and its embedded hotspots.
+func (a *v1Adapter) convertScreen(row v1Row) error {
+	screenId := row.integer("id")
+
+	alignment := v1Alignments[row.integer("alignment")]
+	if alignment == "" {
+		alignment = "center"
+	}
+
+	err := a.insert("Screen", dbx.Params{
+		"id":          screenId,
+		"prototypeId": row.integer("versionId"),
+		"order":       row.integer("order"),
+		"title":       row.str("title"),
+		"alignment":   alignment,
+		"background":  row.str("background"),
+		"fixedHeader": 0,
+		"fixedFooter": 0,
+		"filePath":    v1StorageKey(row.str("imageUrl")),
+		"createdAt":   row.date("createdAt"),
+		"updatedAt":   row.date("updatedAt"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// v1 hotspots are stored as {"hotspot_key": {"left": 0, "top": 0, "width": 0, "height": 0, "link": "", "transition": ""}}
+	raw := strings.TrimSpace(row.str("hotspots"))
+	if raw == "" || raw == "[]" || raw == "null" {
+		return nil // no hotspots
+	}
+
+	hotspots := map[string]map[string]any{}
+	if err := json.Unmarshal([]byte(raw), &hotspots); err != nil {
+		a.m.logger.Warn("Failed to read v1 screen hotspots", "step", "v1", "v1Id", screenId, "error", err)
+		return nil
+	}
+
+	keys := make([]string, 0, len(hotspots))
+	for k := range hotspots {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for i, key := range keys {
+		if i >= v1HotspotsPerScreen {
+			a.m.logger.Warn("Too many v1 screen hotspots", "step", "v1", "v1Id", screenId, "skipped", len(keys)-i)
+			break
+		}
+
+		h := hotspots[key]
+
+		hotspotType, settings := v1HotspotLink(cast.ToString(h["link"]), cast.ToString(h["transition"]))
+		if hotspotType == "" {
+			a.m.logger.Warn("Unsupported v1 hotspot link", "step", "v1", "v1Id", screenId, "hotspot", key, "link", h["link"])
+			continue
+		}
+
+		rawSettings, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+
+		err = a.insert("Hotspot", dbx.Params{
+			"id":        screenId*v1HotspotsPerScreen + i + 1,
+			"screenId":  screenId,
+			"type":      hotspotType,
+			"left":      cast.ToFloat64(h["left"]),
+			"top":       cast.ToFloat64(h["top"]),
+			"width":     cast.ToFloat64(h["width"]),
+			"height":    cast.ToFloat64(h["height"]),
+			"settings":  string(rawSettings),
+			"createdAt": row.date("createdAt"),
+			"updatedAt": row.date("updatedAt"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// v1HotspotLink returns the v2 hotspot type and settings of a v1 hotspot link.
+//
+// Returns an empty type for unsupported links.
+func v1HotspotLink(link string, transition string) (string, map[string]any) {
+	switch {
+	case link == "back", link == "prev", link == "next":
+		return link, map[string]any{"transition": transition}
+	case strings.HasPrefix(link, "http://"), strings.HasPrefix(link, "https://"), strings.HasPrefix(link, "mailto:"):
+		return "url", map[string]any{"url": link}
+	}
+
+	if screenId, err := strconv.Atoi(link); err == nil && screenId > 0 {
+		return "screen", map[string]any{"screenId": screenId, "transition": transition}
+	}
+
+	return "", nil
+}
+
+func (a *v1Adapter) convertScreenComment(row v1Row) error {
+	var replyTo any
+	if id := row.integer("replyTo"); id > 0 {
+		replyTo = id
+	}
+
+	status := "pending"
+	if row.integer("status") == 1 {
+		status = "resolved"
+	}
+
+	return a.insert("ScreenComment", dbx.Params{
+		"id":        row.integer("id"),
+		"replyTo":   replyTo,
+		"screenId":  row.integer("screenId"),
+		"from":      row.str("from"),
+		"message":   row.str("message"),
+		"left":      row.float("posX"),
+		"top":       row.float("posY"),
+		"status":    status,
+		"createdAt": row.date("createdAt"),
+		"updatedAt": row.date("updatedAt"),
+	})
+}
+
+func (a *v1Adapter) convertUserScreenCommentRel(row v1Row) error {
+	return a.insert("UserScreenCommentRel", dbx.Params{
+		"id":              row.integer("id"),
+		"userId":          row.integer("userId"),
+		"screenCommentId": row.integer("screenCommentId"),
+		"isRead":          row.integer("isRead"),
+		"isProcessed":     1, // v1 doesn't track the sent notifications
+		"createdAt":       row.date("createdAt"),
+		"updatedAt":       row.date("updatedAt"),
+	})
+}
+
+// convertProjectPreview converts a v1 ProjectPreview to a v2 ProjectLink.
+//
+// The v1 preview types are 1 (view only) and 2 (view and comment).
+func (a *v1Adapter) convertProjectPreview(row v1Row) error {
+	allowComments := 0
+	if row.integer("type") == 2 {
+		allowComments = 1
+	}
+
+	return a.insert("ProjectLink", dbx.Params{
+		"id":             row.integer("id"),
+		"projectId":      row.integer("projectId"),
+		"slug":           row.str("slug"),
+		"passwordHash":   a.projectPasswords[row.integer("projectId")],
+		"allowComments":  allowComments,
+		"allowGuideline": 0,
+		"createdAt":      row.date("createdAt"),
+		"updatedAt":      row.date("updatedAt"),
+	})
+}
+
+func (a *v1Adapter) convertMigration(row v1Row) error {
+	return a.insert("migration", dbx.Params{
+		"version":    row.str("version"),
+		"apply_time": row.integer("apply_time"),
+	})
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pocketbase/dbx"
+)
+
+const (
+	sslModeDisable    = "disable"
+	sslModeRequire    = "require"
+	sslModeVerifyCA   = "verify-ca"
+	sslModeVerifyFull = "verify-full"
+)
+
+// mysqlTLSConfigName is the name of the registered MySQL driver TLS config.
+const mysqlTLSConfigName = "v2tov3migrate"
+
+// v2PingTimeout is the max time to wait for the v2 DB connectivity check.
+const v2PingTimeout = 10 * time.Second
+
+// V2DBConfig defines the structured v2 DB connection settings
+// (alternative to the driver specific Config.V2DBConnection DSN).
+type V2DBConfig struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	Database string `json:"database,omitempty"`
+
+	// SSLMode could be "disable" (default), "require", "verify-ca" or "verify-full"
+	// (the same values are used for both MySQL and PostgreSQL).
+	SSLMode string `json:"sslmode,omitempty"`
+
+	// Optional TLS certificates file paths.
+	CACert     string `json:"caCert,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+}
+
+// V2DBOptions defines the v2 DB connection pool and session settings.
+//
+// The durations are in Go format (eg. "30s", "5m").
+type V2DBOptions struct {
+	MaxOpenConns    int    `json:"maxOpenConns,omitempty"`
+	MaxIdleConns    int    `json:"maxIdleConns,omitempty"`
+	ConnMaxLifetime string `json:"connMaxLifetime,omitempty"`
+
+	// QueryTimeout is the server-side statement timeout
+	// (MySQL max_execution_time or Postgres statement_timeout).
+	QueryTimeout string `json:"queryTimeout,omitempty"`
+
+	// ReadOnly starts every v2 DB session in read-only transaction mode.
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// Validate checks whether the duration options are valid.
+func (o V2DBOptions) Validate() error {
+	if o.MaxOpenConns < 0 || o.MaxIdleConns < 0 {
+		return errors.New("v2DBOptions.maxOpenConns and v2DBOptions.maxIdleConns must be non-negative")
+	}
+
+	if _, err := parseOptionalDuration(o.ConnMaxLifetime); err != nil {
+		return fmt.Errorf("invalid v2DBOptions.connMaxLifetime: %w", err)
+	}
+
+	if _, err := parseOptionalDuration(o.QueryTimeout); err != nil {
+		return fmt.Errorf("invalid v2DBOptions.queryTimeout: %w", err)
+	}
+
+	return nil
+}
+
+// applyPool applies the connection pool options to the provided db.
+func (o V2DBOptions) applyPool(db *sql.DB) {
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+
+	if lifetime, _ := parseOptionalDuration(o.ConnMaxLifetime); lifetime > 0 {
+		db.SetConnMaxLifetime(lifetime)
+	}
+}
+
+// sessionParams returns the driver specific session variables
+// that should be set for each new connection.
+func (o V2DBOptions) sessionParams(driver string) map[string]string {
+	params := map[string]string{}
+
+	timeout, _ := parseOptionalDuration(o.QueryTimeout)
+
+	switch driver {
+	case "mysql":
+		if o.ReadOnly {
+			params["transaction_read_only"] = "1"
+		}
+		if timeout > 0 {
+			params["max_execution_time"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+		}
+	case "pgx":
+		if o.ReadOnly {
+			params["default_transaction_read_only"] = "on"
+		}
+		if timeout > 0 {
+			params["statement_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+		}
+	}
+
+	return params
+}
+
+func parseOptionalDuration(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(raw)
+}
+
+// V2DSN returns the v2 DB driver specific DSN.
+//
+// If Config.V2DBConnection is set it is used as base,
+// otherwise the DSN is build from the structured Config.V2DB settings.
+//
+// The Config.V2DBOptions session params are appended to the returned DSN.
+func (c *Config) V2DSN() (string, error) {
+	params := c.V2DBOptions.sessionParams(c.V2DBDriver)
+
+	switch c.V2DBDriver {
+	case "mysql":
+		if c.V2DBConnection != "" && len(params) == 0 {
+			return c.V2DBConnection, nil
+		}
+		if c.V2DBConnection != "" {
+			cfg, err := mysql.ParseDSN(c.V2DBConnection)
+			if err != nil {
+				return "", fmt.Errorf("invalid v2DBConnection: %w", err)
+			}
+			return withMySQLParams(cfg, params), nil
+		}
+		return c.V2DB.mysqlDSN(params)
+	case "pgx":
+		if c.V2DBConnection != "" {
+			return withPgxParams(c.V2DBConnection, params)
+		}
+		return withPgxParams(c.V2DB.pgxDSN(), params)
+	default:
+		return "", fmt.Errorf("unsupported v2DBDriver %q", c.V2DBDriver)
+	}
+}
+
+// PingV2DB checks whether the v2 DB is reachable with the current config.
+func (c *Config) PingV2DB() error {
+	dsn, err := c.V2DSN()
+	if err != nil {
+		return err
+	}
+
+	db, err := dbx.Open(c.V2DBDriver, dsn)
+	if err != nil {
+		return fmt.Errorf("unable to open the v2 database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), v2PingTimeout)
+	defer cancel()
+
+	if err := db.DB().PingContext(ctx); err != nil {
+		target := c.V2DB.Host
+		if target == "" {
+			target = "v2DBConnection"
+		}
+		return fmt.Errorf("unable to connect to the v2 %s database (%s): %w", c.V2DBDriver, target, err)
+	}
+
+	return nil
+}
+
+func (c V2DBConfig) mysqlDSN(params map[string]string) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.portOrDefault(3306)))
+	cfg.DBName = c.Database
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return "", err
+	}
+	if tlsConfig != nil {
+		if err := mysql.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+			return "", err
+		}
+		cfg.TLSConfig = mysqlTLSConfigName
+	}
+
+	return withMySQLParams(cfg, params), nil
+}
+
+func withMySQLParams(cfg *mysql.Config, params map[string]string) string {
+	if len(params) > 0 && cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+
+	for k, v := range params {
+		cfg.Params[k] = v
+	}
+
+	return cfg.FormatDSN()
+}
+
+// withPgxParams appends the provided runtime params to a pgx DSN
+// (either in URL or in keyword/value format).
+func withPgxParams(dsn string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return dsn, nil
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid v2DBConnection: %w", err)
+		}
+
+		query := u.Query()
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+
+		return u.String(), nil
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		dsn += " " + k + "=" + params[k]
+	}
+
+	return strings.TrimSpace(dsn), nil
+}
+
+func (c V2DBConfig) pgxDSN() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   net.JoinHostPort(c.Host, strconv.Itoa(c.portOrDefault(5432))),
+		Path:   "/" + c.Database,
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", c.sslMode())
+	if c.CACert != "" {
+		query.Set("sslrootcert", c.CACert)
+	}
+	if c.ClientCert != "" {
+		query.Set("sslcert", c.ClientCert)
+	}
+	if c.ClientKey != "" {
+		query.Set("sslkey", c.ClientKey)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (c V2DBConfig) portOrDefault(defaultPort int) int {
+	if c.Port > 0 {
+		return c.Port
+	}
+
+	return defaultPort
+}
+
+func (c V2DBConfig) sslMode() string {
+	if c.SSLMode == "" {
+		return sslModeDisable
+	}
+
+	return c.SSLMode
+}
+
+// tlsConfig builds a [tls.Config] from the current ssl settings
+// (it is used only with the MySQL driver because pgx supports them natively).
+//
+// Returns nil if the ssl mode is "disable".
+func (c V2DBConfig) tlsConfig() (*tls.Config, error) {
+	mode := c.sslMode()
+	if mode == sslModeDisable {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: c.Host}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA cert: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("failed to parse the CA cert")
+		}
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client cert and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case sslModeRequire:
+		tlsConfig.InsecureSkipVerify = true
+	case sslModeVerifyCA:
+		// verify the certificate chain but not the host name
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertChain(rawCerts, tlsConfig.RootCAs)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func verifyCertChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("missing server certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestV2DBOptionsValidate(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		options     V2DBOptions
+		expectError bool
+	}{
+		{"zero", V2DBOptions{}, false},
+		{"valid", V2DBOptions{MaxOpenConns: 10, MaxIdleConns: 5, ConnMaxLifetime: "30m", QueryTimeout: "30s"}, false},
+		{"negative max open conns", V2DBOptions{MaxOpenConns: -1}, true},
+		{"negative max idle conns", V2DBOptions{MaxIdleConns: -1}, true},
+		{"invalid conn max lifetime", V2DBOptions{ConnMaxLifetime: "abc"}, true},
+		{"invalid query timeout", V2DBOptions{QueryTimeout: "10"}, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			err := s.options.Validate()
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+		})
+	}
+}
+
+func TestWithPgxParams(t *testing.T) {
+	params := map[string]string{
+		"statement_timeout":             "30000",
+		"default_transaction_read_only": "on",
+	}
+
+	scenarios := []struct {
+		name        string
+		dsn         string
+		params      map[string]string
+		expected    string
+		expectError bool
+	}{
+		{"no params", "host=a dbname=b", nil, "host=a dbname=b", false},
+		{"keyword/value", "host=a dbname=b", params, "host=a dbname=b default_transaction_read_only=on statement_timeout=30000", false},
+		{"empty keyword/value", "", params, "default_transaction_read_only=on statement_timeout=30000", false},
+		{"url", "postgres://u:p@a:5432/b", params, "postgres://u:p@a:5432/b?default_transaction_read_only=on&statement_timeout=30000", false},
+		{"postgresql url with query", "postgresql://a/b?sslmode=require&statement_timeout=1", params, "postgresql://a/b?default_transaction_read_only=on&sslmode=require&statement_timeout=30000", false},
+		{"invalid url", "postgres://a:b:c/d", params, "", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result, err := withPgxParams(s.dsn, s.params)
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if result != s.expected {
+				t.Fatalf("expected\n%q\ngot\n%q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestV2DSN(t *testing.T) {
+	db := V2DBConfig{Host: "db.example.com", User: "u", Password: "p@ss", Database: "presentator"}
+	options := V2DBOptions{ReadOnly: true, QueryTimeout: "30s"}
+
+	scenarios := []struct {
+		name        string
+		config      Config
+		expected    string
+		expectError bool
+	}{
+		{
+			"mysql structured",
+			Config{V2DBDriver: "mysql", V2DB: db},
+			"u:p@ss@tcp(db.example.com:3306)/presentator",
+			false,
+		},
+		{
+			"mysql structured with port and options",
+			Config{V2DBDriver: "mysql", V2DB: V2DBConfig{Host: "::1", Port: 3307, User: "u", Database: "p"}, V2DBOptions: options},
+			"u@tcp([::1]:3307)/p?max_execution_time=30000&transaction_read_only=1",
+			false,
+		},
+		{
+			"mysql connection without options",
+			Config{V2DBDriver: "mysql", V2DBConnection: "u:p@tcp(a)/b?parseTime=true"},
+			"u:p@tcp(a)/b?parseTime=true",
+			false,
+		},
+		{
+			"mysql connection with options",
+			Config{V2DBDriver: "mysql", V2DBConnection: "u:p@tcp(a:3306)/b?charset=utf8mb4", V2DBOptions: options},
+			"u:p@tcp(a:3306)/b?charset=utf8mb4&max_execution_time=30000&transaction_read_only=1",
+			false,
+		},
+		{
+			"mysql invalid connection",
+			Config{V2DBDriver: "mysql", V2DBConnection: "invalid", V2DBOptions: options},
+			"",
+			true,
+		},
+		{
+			"pgx structured",
+			Config{V2DBDriver: "pgx", V2DB: V2DBConfig{Host: "a", User: "u", Password: "p", Database: "b", SSLMode: sslModeVerifyFull, CACert: "/ca.pem"}},
+			"postgres://u:p@a:5432/b?sslmode=verify-full&sslrootcert=%2Fca.pem",
+			false,
+		},
+		{
+			"pgx connection with options",
+			Config{V2DBDriver: "pgx", V2DBConnection: "host=a dbname=b", V2DBOptions: options},
+			"host=a dbname=b default_transaction_read_only=on statement_timeout=30000",
+			false,
+		},
+		{
+			"unsupported driver",
+			Config{V2DBDriver: "sqlite", V2DB: db},
+			"",
+			true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result, err := s.config.V2DSN()
+			if hasErr := err != nil; hasErr != s.expectError {
+				t.Fatalf("expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if result != s.expected {
+				t.Fatalf("expected\n%q\ngot\n%q", s.expected, result)
+			}
+		})
+	}
+}